@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// canonicalizer maps the different shapes a site uses for one resource to a
+// single identity key. It reports false for URLs it doesn't recognise, in
+// which case normalizeURL falls back to generic normalization.
+type canonicalizer func(u *url.URL) (string, bool)
+
+// canonicalizers is keyed by host. Subdomains fall back to their parent
+// domain's entry, so en.m.wikipedia.org uses the wikipedia.org one.
+var canonicalizers = map[string]canonicalizer{
+	"reddit.com":           canonicalReddit,
+	"arxiv.org":            canonicalArxiv,
+	"youtube.com":          canonicalYouTube,
+	"youtube-nocookie.com": canonicalYouTube,
+	"youtu.be":             canonicalYouTube,
+	"wikipedia.org":        canonicalWikipedia,
+}
+
+// hostCanonicalizers only apply to their exact host, because their paths
+// mean something else on a subdomain: gist.github.com/user/abc is a gist,
+// not the repository github.com/user/abc, and i.redd.it/abc.jpg an image,
+// not a post.
+var hostCanonicalizers = map[string]canonicalizer{
+	"github.com":                canonicalGitHub,
+	"raw.githubusercontent.com": canonicalGitHubRaw,
+	"redd.it":                   canonicalReddit,
+}
+
+func canonicalizerFor(host string) (canonicalizer, bool) {
+	host = strings.TrimPrefix(host, "www.")
+	if c, ok := hostCanonicalizers[host]; ok {
+		return c, true
+	}
+	for _, h := range parentDomains(host) {
+		if c, ok := canonicalizers[h]; ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+func canonicalReddit(u *url.URL) (string, bool) {
+	return normalizeRedditURL(u.String()), true
+}
+
+// githubReserved are top-level GitHub paths that aren't user or org names.
+var githubReserved = map[string]bool{
+	"about": true, "collections": true, "enterprise": true, "events": true,
+	"explore": true, "features": true, "login": true, "marketplace": true,
+	"new": true, "notifications": true, "orgs": true, "organizations": true,
+	"pricing": true, "search": true, "settings": true, "site": true,
+	"sponsors": true, "topics": true, "trending": true,
+}
+
+var readmeRegex = regexp.MustCompile(`(?i)^readme(\.[a-z]+)?$`)
+
+// canonicalGitHub collapses a repository's root, .git clone URL, default
+// branch tree and top-level README onto github.com/owner/repo, whatever
+// their query. Deeper pages keep their non-tracking query, since
+// issues?q=is:open and issues?q=is:closed are different lists. Owner and
+// repo are lowercased since GitHub treats them case-insensitively.
+func canonicalGitHub(u *url.URL) (string, bool) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || githubReserved[strings.ToLower(parts[0])] {
+		return "", false
+	}
+
+	owner := strings.ToLower(parts[0])
+	repo := strings.ToLower(strings.TrimSuffix(parts[1], ".git"))
+	key := "github.com/" + owner + "/" + repo
+	rest := parts[2:]
+
+	switch {
+	case len(rest) == 0:
+		return key, true
+	case len(rest) == 2 && rest[0] == "tree" && isDefaultBranch(rest[1]):
+		return key, true
+	case len(rest) == 3 && rest[0] == "blob" && isDefaultBranch(rest[1]) && readmeRegex.MatchString(rest[2]):
+		return key, true
+	}
+
+	key += "/" + strings.Join(rest, "/")
+	if query := cleanQuery("github.com", u.RawQuery); query != "" {
+		key += "?" + query
+	}
+	return key, true
+}
+
+// canonicalGitHubRaw maps raw file URLs onto their blob page.
+func canonicalGitHubRaw(u *url.URL) (string, bool) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 4 {
+		return "", false
+	}
+	blob := &url.URL{Path: "/" + parts[0] + "/" + parts[1] + "/blob/" + strings.Join(parts[2:], "/")}
+	return canonicalGitHub(blob)
+}
+
+func isDefaultBranch(branch string) bool {
+	return branch == "main" || branch == "master"
+}
+
+// arxivRegex matches new-style (2401.01234) and old-style (hep-th/9901001)
+// identifiers behind any of the abs, pdf, html or format views, with an
+// optional version suffix and .pdf extension.
+var arxivRegex = regexp.MustCompile(`^/(?:abs|pdf|html|format)/((?:[a-z\-]+(?:\.[A-Z]{2})?/)?\d{4}\.?\d{3,5})(?:v\d+)?(?:\.pdf)?/?$`)
+
+func canonicalArxiv(u *url.URL) (string, bool) {
+	matches := arxivRegex.FindStringSubmatch(u.Path)
+	if len(matches) < 2 {
+		return "", false
+	}
+	return "arxiv.org/abs/" + matches[1], true
+}
+
+var youtubeIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// canonicalYouTube maps youtu.be, /watch, /shorts, /embed, /live and /v
+// links to youtube.com/watch?v=ID.
+func canonicalYouTube(u *url.URL) (string, bool) {
+	var id string
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch {
+	case u.Host == "youtu.be" && len(parts) >= 1:
+		id = parts[0]
+	case len(parts) == 1 && parts[0] == "watch":
+		id = u.Query().Get("v")
+	case len(parts) >= 2 && (parts[0] == "shorts" || parts[0] == "embed" || parts[0] == "live" || parts[0] == "v"):
+		id = parts[1]
+	}
+
+	if !youtubeIDRegex.MatchString(id) {
+		return "", false
+	}
+	return "youtube.com/watch?v=" + id, true
+}
+
+// canonicalWikipedia maps mobile and index.php?title= article links to
+// <lang>.wikipedia.org/wiki/Title.
+func canonicalWikipedia(u *url.URL) (string, bool) {
+	labels := strings.Split(u.Host, ".")
+	if len(labels) < 3 {
+		return "", false
+	}
+	lang := labels[0]
+
+	var title string
+	switch {
+	case strings.HasPrefix(u.Path, "/wiki/"):
+		title = strings.TrimPrefix(u.Path, "/wiki/")
+	case u.Path == "/w/index.php":
+		title = u.Query().Get("title")
+	}
+
+	title = strings.ReplaceAll(strings.TrimSpace(title), " ", "_")
+	if title == "" {
+		return "", false
+	}
+
+	// The first letter of an article title is case-insensitive.
+	r, size := utf8.DecodeRuneInString(title)
+	title = string(unicode.ToUpper(r)) + title[size:]
+
+	return lang + ".wikipedia.org/wiki/" + (&url.URL{Path: title}).EscapedPath(), true
+}
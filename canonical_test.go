@@ -0,0 +1,159 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalizers(t *testing.T) {
+	testCases := []struct {
+		name     string
+		variants []string
+		expected string
+	}{
+		{
+			name: "GitHub repository",
+			variants: []string{
+				"https://github.com/golang/go",
+				"https://github.com/golang/go/",
+				"https://www.github.com/Golang/Go",
+				"https://github.com/golang/go.git",
+				"https://github.com/golang/go/tree/master",
+				"https://github.com/golang/go/blob/master/README.md",
+				"https://github.com/golang/go#readme",
+				"https://github.com/golang/go?tab=readme-ov-file",
+			},
+			expected: "github.com/golang/go",
+		},
+		{
+			name: "GitHub file",
+			variants: []string{
+				"https://github.com/golang/go/blob/master/src/net/url/url.go",
+				"https://raw.githubusercontent.com/golang/go/master/src/net/url/url.go",
+			},
+			expected: "github.com/golang/go/blob/master/src/net/url/url.go",
+		},
+		{
+			name: "arXiv paper",
+			variants: []string{
+				"https://arxiv.org/abs/2401.01234",
+				"https://arxiv.org/abs/2401.01234v3",
+				"https://arxiv.org/pdf/2401.01234",
+				"https://arxiv.org/pdf/2401.01234v2",
+				"https://arxiv.org/pdf/2401.01234v2.pdf",
+				"http://export.arxiv.org/abs/2401.01234",
+				"https://arxiv.org/html/2401.01234v1",
+			},
+			expected: "arxiv.org/abs/2401.01234",
+		},
+		{
+			name: "Old-style arXiv paper",
+			variants: []string{
+				"https://arxiv.org/abs/hep-th/9901001",
+				"https://arxiv.org/pdf/hep-th/9901001v1",
+			},
+			expected: "arxiv.org/abs/hep-th/9901001",
+		},
+		{
+			name: "YouTube video",
+			variants: []string{
+				"https://youtu.be/dQw4w9WgXcQ",
+				"https://youtu.be/dQw4w9WgXcQ?si=tracking",
+				"https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+				"https://m.youtube.com/watch?v=dQw4w9WgXcQ&t=42",
+				"https://www.youtube.com/shorts/dQw4w9WgXcQ",
+				"https://www.youtube.com/embed/dQw4w9WgXcQ",
+				"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ",
+				"https://www.youtube.com/live/dQw4w9WgXcQ?feature=share",
+			},
+			expected: "youtube.com/watch?v=dQw4w9WgXcQ",
+		},
+		{
+			name: "Wikipedia article",
+			variants: []string{
+				"https://en.wikipedia.org/wiki/Go_(programming_language)",
+				"https://en.m.wikipedia.org/wiki/Go_(programming_language)",
+				"https://en.wikipedia.org/wiki/go_(programming_language)",
+				"https://en.wikipedia.org/w/index.php?title=Go_(programming_language)",
+				"https://en.wikipedia.org/wiki/Go%20(programming%20language)",
+			},
+			expected: "en.wikipedia.org/wiki/Go_%28programming_language%29",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, v := range tc.variants {
+				if got := normalizeURL(v); got != tc.expected {
+					t.Errorf("normalizeURL(%q) = %q, want %q", v, got, tc.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestCanonicalizersLeaveOthersAlone(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "GitHub non-repository page",
+			input:    "https://github.com/features/copilot",
+			expected: "https://github.com/features/copilot",
+		},
+		{
+			name:     "GitHub non-default branch",
+			input:    "https://github.com/golang/go/tree/release-branch.go1.22",
+			expected: "github.com/golang/go/tree/release-branch.go1.22",
+		},
+		{
+			name:     "GitHub page query",
+			input:    "https://github.com/golang/go/issues?q=is:open&utm_source=hn",
+			expected: "github.com/golang/go/issues?q=is%3Aopen",
+		},
+		{
+			name:     "GitHub gist",
+			input:    "https://gist.github.com/user/abc",
+			expected: "https://gist.github.com/user/abc",
+		},
+		{
+			name:     "GitHub docs",
+			input:    "https://docs.github.com/en/actions/",
+			expected: "https://docs.github.com/en/actions",
+		},
+		{
+			name:     "GitHub API",
+			input:    "https://api.github.com/repos/golang/go",
+			expected: "https://api.github.com/repos/golang/go",
+		},
+		{
+			name:     "Reddit image host",
+			input:    "https://i.redd.it/abc123.jpg",
+			expected: "https://i.redd.it/abc123.jpg",
+		},
+		{
+			name:     "arXiv listing page",
+			input:    "https://arxiv.org/list/cs.AI/recent",
+			expected: "https://arxiv.org/list/cs.AI/recent",
+		},
+		{
+			name:     "YouTube channel",
+			input:    "https://www.youtube.com/@golang",
+			expected: "https://youtube.com/@golang",
+		},
+		{
+			name:     "Different Wikipedia languages",
+			input:    "https://de.wikipedia.org/wiki/Go_(Programmiersprache)",
+			expected: "de.wikipedia.org/wiki/Go_%28Programmiersprache%29",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := normalizeURL(tc.input); got != tc.expected {
+				t.Errorf("normalizeURL(%q) = %q, want %q", tc.input, got, tc.expected)
+			}
+		})
+	}
+}
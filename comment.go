@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// commentText renders the bot comment for a link post from the comment
+// template, or returns "" if the story's HN ID is unknown.
+func (a *App) commentText(ctx context.Context, story Story) string {
+	if story.HNURL() == "" {
+		logger.Printf("Warning: no HN item ID for '%s', skipping comment\n", story.Title)
+		return ""
+	}
+	return a.templates.Comment(newTemplateData(story, a.history.Previous(ctx, story), time.Now()))
+}
+
+// storyStats renders story's points, comment count and age as a line of
+// the bot comment, or "" if none are known.
+func storyStats(story Story, now time.Time) string {
+	var parts []string
+	if story.Points > 0 || story.Comments > 0 {
+		parts = append(parts, plural(story.Points, "point"), plural(story.Comments, "comment"))
+	}
+	if !story.Time.IsZero() {
+		parts = append(parts, "posted "+humanAge(now.Sub(story.Time))+" ago")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "*" + strings.Join(parts, ", ") + "*"
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// humanAge rounds d down to the largest whole unit, as HN does.
+func humanAge(d time.Duration) string {
+	switch {
+	case d < 2*time.Minute:
+		return "1 minute"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	}
+	return plural(int(d/(24*time.Hour)), "day")
+}
+
+// stickyComment distinguishes the bot's comment on postName and pins it to
+// the top of the thread, recording the comment and whether that worked so
+// retryStickies and refreshComments can find it later. A failure is only
+// logged.
+func (a *App) stickyComment(ctx context.Context, postName, commentName, text string) {
+	stickied := false
+	if a.cfg.Comment.Sticky {
+		if err := a.api.Distinguish(ctx, commentName, true); err != nil {
+			logger.Printf("Warning: failed to sticky comment %s: %v\n", commentName, err)
+		} else {
+			stickied = true
+		}
+	}
+
+	if err := a.store.RecordComment(postName, commentName, text, stickied); err != nil {
+		logger.Printf("Warning: failed to record comment %s in store: %v\n", commentName, err)
+	}
+}
+
+// retryStickies stickies comments from the dedupe window that failed to
+// sticky when they were posted.
+func (a *App) retryStickies(ctx context.Context) {
+	if !a.cfg.Comment.Sticky || !a.cfg.Comment.RetrySticky {
+		return
+	}
+
+	since := time.Now().Add(-time.Duration(a.cfg.Dedupe.CheckHours) * time.Hour)
+	for _, p := range a.store.UnstickiedComments(since) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := a.api.Distinguish(ctx, p.Comment, true); err != nil {
+			logger.Printf("Warning: still failed to sticky comment %s on %s: %v\n", p.Comment, p.Name, err)
+			continue
+		}
+
+		logger.Printf("Stickied comment %s on %s\n", p.Comment, p.Name)
+		if err := a.store.SetStickied(p.Name); err != nil {
+			logger.Printf("Warning: failed to record comment %s in store: %v\n", p.Comment, err)
+		}
+	}
+}
+
+// refreshComments edits the bot comments on posts made within
+// comment.refresh_for to show the current stats of their stories. stories
+// is what the source returned this run; once a story is no longer in it,
+// it has dropped off HN and its comment is left as it is.
+func (a *App) refreshComments(ctx context.Context, stories []Story) {
+	if a.cfg.Comment.RefreshFor <= 0 {
+		return
+	}
+
+	current := make(map[int]Story, len(stories))
+	for _, story := range mergeStories(stories) {
+		if story.ID != 0 {
+			current[story.ID] = story
+		}
+	}
+
+	since := time.Now().Add(-a.cfg.Comment.RefreshFor)
+	for _, lc := range a.store.LiveComments(since) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		story, ok := current[lc.HNID]
+		if !ok {
+			logger.Printf("HN story %d dropped off, no longer updating comment %s\n", lc.HNID, lc.Post.Comment)
+			if err := a.store.UpdateComment(lc.Post.Name, lc.Post.CommentText, true); err != nil {
+				logger.Printf("Warning: failed to record comment %s in store: %v\n", lc.Post.Comment, err)
+			}
+			continue
+		}
+
+		text := a.commentText(ctx, story)
+		if text == "" || text == lc.Post.CommentText {
+			continue
+		}
+
+		if err := a.api.EditText(ctx, lc.Post.Comment, text); err != nil {
+			logger.Printf("Warning: failed to update comment %s: %v\n", lc.Post.Comment, err)
+			continue
+		}
+		if err := a.store.UpdateComment(lc.Post.Name, text, false); err != nil {
+			logger.Printf("Warning: failed to record comment %s in store: %v\n", lc.Post.Comment, err)
+		}
+	}
+}
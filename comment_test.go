@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStickyComment(t *testing.T) {
+	st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	api := &fakeRedditAPI{fail: map[string]error{"Distinguish": errors.New("not a moderator")}}
+	app := &App{cfg: defaultConfig(), store: st, api: api}
+
+	story := Story{ID: 1, Title: "A story", URL: "https://example.com/a"}
+	if err := st.RecordPost(story, "hackernews", "t3_a"); err != nil {
+		t.Fatalf("RecordPost: %v", err)
+	}
+
+	app.stickyComment(context.Background(), "t3_a", "t1_a", "Discussion on HN")
+	if pending := st.UnstickiedComments(story.Time); len(pending) != 1 || pending[0].Comment != "t1_a" {
+		t.Fatalf("got %+v, want the failed sticky pending", pending)
+	}
+
+	// The next run tries again, and stops once it works.
+	api.fail = nil
+	app.retryStickies(context.Background())
+	app.retryStickies(context.Background())
+
+	want := []string{"Distinguish t1_a true", "Distinguish t1_a true"}
+	if fmt.Sprint(api.calls) != fmt.Sprint(want) {
+		t.Errorf("calls = %q, want %q", api.calls, want)
+	}
+	if pending := st.UnstickiedComments(story.Time); len(pending) != 0 {
+		t.Errorf("got %+v, want nothing pending", pending)
+	}
+
+	reopened, err := openStore(st.path)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	if _, p, ok := reopened.FindPostedHN(1, "hackernews"); !ok || p.Comment != "t1_a" || !p.Stickied {
+		t.Errorf("stored post = %+v, want comment t1_a stickied", p)
+	}
+}
+
+func TestStoryStats(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name  string
+		story Story
+		want  string
+	}{
+		{"Nothing known", Story{}, ""},
+		{"Fresh", Story{Points: 1, Comments: 0, Time: now.Add(-30 * time.Second)}, "*1 point, 0 comments, posted 1 minute ago*"},
+		{"Hours", Story{Points: 250, Comments: 97, Time: now.Add(-5*time.Hour - 59*time.Minute)}, "*250 points, 97 comments, posted 5 hours ago*"},
+		{"Days", Story{Time: now.Add(-49 * time.Hour)}, "*posted 2 days ago*"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := storyStats(tc.story, now); got != tc.want {
+				t.Errorf("storyStats = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRefreshComments(t *testing.T) {
+	st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	api := &fakeRedditAPI{}
+	app := &App{cfg: defaultConfig(), store: st, api: api}
+
+	posted := time.Now().Add(-time.Hour)
+	stories := []Story{
+		{ID: 1, Title: "Still on HN", URL: "https://example.com/1", Points: 100, Comments: 10, Time: posted},
+		{ID: 2, Title: "Dropping off", URL: "https://example.com/2", Points: 100, Comments: 10, Time: posted},
+	}
+	for i, story := range stories {
+		post := fmt.Sprintf("t3_%d", i+1)
+		if err := st.RecordPost(story, "hackernews", post); err != nil {
+			t.Fatalf("RecordPost: %v", err)
+		}
+		if err := st.RecordComment(post, fmt.Sprintf("t1_%d", i+1), app.commentText(context.Background(), story), true); err != nil {
+			t.Fatalf("RecordComment: %v", err)
+		}
+	}
+
+	// Nothing changed yet, so nothing is edited.
+	app.refreshComments(context.Background(), stories)
+	if len(api.calls) != 0 {
+		t.Fatalf("calls = %q, want no edits", api.calls)
+	}
+
+	stories[0].Points = 150
+	app.refreshComments(context.Background(), stories[:1])
+	app.refreshComments(context.Background(), stories[:1])
+
+	if len(api.calls) != 1 || !strings.HasPrefix(api.calls[0], "EditText t1_1 ") || !strings.Contains(api.calls[0], "150 points") {
+		t.Errorf("calls = %q, want one edit of t1_1 with the new points", api.calls)
+	}
+
+	live := st.LiveComments(time.Time{})
+	if len(live) != 1 || live[0].HNID != 1 {
+		t.Errorf("live comments = %+v, want only story 1 once story 2 dropped off", live)
+	}
+}
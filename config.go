@@ -0,0 +1,715 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const DEFAULT_CONFIG_FILE = "hnbot.toml"
+
+// Config is everything that used to be a compile-time constant. Values
+// are layered: defaults, then the TOML file, then environment variables,
+// then command-line flags.
+type Config struct {
+	StateFile      string          `toml:"state_file"`
+	StateRetention time.Duration   `toml:"state_retention"`
+	DryRun         bool            `toml:"dry_run"`
+	PlanJSON       bool            `toml:"plan_json"`
+	PlanFile       string          `toml:"plan_file"`
+	Reddit         RedditConfig    `toml:"reddit"`
+	Feed           FeedConfig      `toml:"feed"`
+	Dedupe         DedupeConfig    `toml:"dedupe"`
+	Resolve        ResolveConfig   `toml:"resolve"`
+	Canonical      CanonicalConfig `toml:"canonical"`
+	History        HistoryConfig   `toml:"history"`
+	Comment        CommentConfig   `toml:"comment"`
+	Title          TitleConfig     `toml:"title"`
+	Templates      TemplateConfig  `toml:"templates"`
+	Daemon         DaemonConfig    `toml:"daemon"`
+	Routes         []RouteConfig   `toml:"routes"`
+	Flair          FlairConfig     `toml:"flair"`
+}
+
+type RedditConfig struct {
+	Subreddit    string        `toml:"subreddit"`
+	Agent        string        `toml:"agent"`
+	Username     string        `toml:"username"`
+	ClientID     string        `toml:"client_id"`
+	Secret       string        `toml:"secret"`
+	Password     string        `toml:"password"`
+	RefreshToken string        `toml:"refresh_token"`
+	Timeout      time.Duration `toml:"timeout"`
+	TokenURL     string        `toml:"token_url"`
+	APIURL       string        `toml:"api_url"`
+}
+
+// FeedConfig controls where stories come from. Sources are tried in
+// order until one succeeds; Protocol, BaseURL, Name and Feeds only apply
+// to hnrss.
+type FeedConfig struct {
+	Sources           []string      `toml:"sources"`
+	Protocol          string        `toml:"protocol"`
+	BaseURL           string        `toml:"base_url"`
+	Name              string        `toml:"name"`
+	Count             int           `toml:"count"`
+	PointsThreshold   int           `toml:"points_threshold"`
+	CommentsThreshold int           `toml:"comments_threshold"`
+	Timeout           time.Duration `toml:"timeout"`
+	FirebaseURL       string        `toml:"firebase_url"`
+	FirebaseList      string        `toml:"firebase_list"`
+	Workers           int           `toml:"workers"`
+	AlgoliaURL        string        `toml:"algolia_url"`
+	Feeds             []HnrssFeed   `toml:"feeds"`
+}
+
+// HnrssFeed is one hnrss.org endpoint, such as "best", "show" or a
+// "newest" keyword search. Unset thresholds fall back to the [feed] ones
+// and an empty Subreddit posts to reddit.subreddit.
+type HnrssFeed struct {
+	Name              string        `toml:"name"`
+	Query             string        `toml:"query"`
+	PointsThreshold   *int          `toml:"points_threshold"`
+	CommentsThreshold *int          `toml:"comments_threshold"`
+	MaxAge            time.Duration `toml:"max_age"`
+	Subreddit         string        `toml:"subreddit"`
+}
+
+// hnrssFeeds returns the configured feeds, or just feed.name when there
+// are none.
+func (c *Config) hnrssFeeds() []HnrssFeed {
+	if len(c.Feed.Feeds) > 0 {
+		return c.Feed.Feeds
+	}
+	return []HnrssFeed{{Name: c.Feed.Name}}
+}
+
+// thresholds returns the feed's points and comments thresholds.
+func (f HnrssFeed) thresholds(cfg *Config) (points, comments int) {
+	points, comments = cfg.Feed.PointsThreshold, cfg.Feed.CommentsThreshold
+	if f.PointsThreshold != nil {
+		points = *f.PointsThreshold
+	}
+	if f.CommentsThreshold != nil {
+		comments = *f.CommentsThreshold
+	}
+	return points, comments
+}
+
+type DedupeConfig struct {
+	CheckHours     int     `toml:"check_hours"`
+	TitleThreshold float64 `toml:"title_threshold"`
+}
+
+// ResolveConfig controls following shortened links before dedupe.
+type ResolveConfig struct {
+	Enabled      bool          `toml:"enabled"`
+	Hosts        []string      `toml:"hosts"`
+	Timeout      time.Duration `toml:"timeout"`
+	MaxRedirects int           `toml:"max_redirects"`
+}
+
+// CanonicalConfig controls using a page's rel=canonical / og:url as its
+// identity. IgnoreDomains lists sites whose canonicals can't be trusted.
+type CanonicalConfig struct {
+	Enabled       bool          `toml:"enabled"`
+	IgnoreDomains []string      `toml:"ignore_domains"`
+	Timeout       time.Duration `toml:"timeout"`
+	CacheTTL      time.Duration `toml:"cache_ttl"`
+}
+
+// HistoryConfig controls listing previous HN discussions of the same URL
+// in the bot comment. Only discussions with at least MinComments are shown.
+type HistoryConfig struct {
+	Enabled     bool          `toml:"enabled"`
+	MinComments int           `toml:"min_comments"`
+	MaxResults  int           `toml:"max_results"`
+	Timeout     time.Duration `toml:"timeout"`
+	CacheTTL    time.Duration `toml:"cache_ttl"`
+}
+
+// StoryMatch is the conditions routes and flair rules select stories by.
+// A story matches when every condition set holds. Types are HN story types
+// (story, ask, show, tell, launch, job, poll), Domains match subdomains too
+// and Keyword is a regexp matched against the title.
+type StoryMatch struct {
+	Types       []string `toml:"types"`
+	TitlePrefix string   `toml:"title_prefix"`
+	Domains     []string `toml:"domains"`
+	Keyword     string   `toml:"keyword"`
+}
+
+// RouteConfig sends stories matching it to Subreddits.
+type RouteConfig struct {
+	StoryMatch
+	Subreddits []string `toml:"subreddits"`
+}
+
+// FlairConfig sets link flair on new posts from the first matching rule.
+// Categories name groups of domains that rules can match on.
+type FlairConfig struct {
+	Enabled    bool                `toml:"enabled"`
+	Categories map[string][]string `toml:"categories"`
+	Rules      []FlairRule         `toml:"rules"`
+}
+
+// FlairRule applies a flair template to matching stories. Category adds a
+// domain category's domains to the match; Subreddits limits the rule to
+// those subreddits, since templates belong to a subreddit. Text overrides
+// the template's text, and is what's set if the template can't be.
+type FlairRule struct {
+	StoryMatch
+	Category   string   `toml:"category"`
+	Subreddits []string `toml:"subreddits"`
+	TemplateID string   `toml:"template_id"`
+	Text       string   `toml:"text"`
+}
+
+// CommentConfig controls the "Discussion on HN" comment on link posts.
+// Sticky distinguishes it as a moderator comment pinned to the top of the
+// thread, which needs the bot to moderate the subreddit. RetrySticky tries
+// again on later runs for posts from the last dedupe.check_hours where
+// that failed. Each run edits comments on posts younger than RefreshFor
+// with the story's current stats, until it drops off HN; 0 disables that.
+type CommentConfig struct {
+	Sticky      bool          `toml:"sticky"`
+	RetrySticky bool          `toml:"retry_sticky"`
+	RefreshFor  time.Duration `toml:"refresh_for"`
+}
+
+// TitleConfig controls how submission titles are tidied. Markers appends
+// HN-style (2019), [pdf] and [video] markers worked out from the link.
+type TitleConfig struct {
+	Markers bool `toml:"markers"`
+}
+
+// TemplateConfig holds text/template templates for the submission title
+// and the bot comment, executed with a TemplateData. Empty uses the
+// built-in templates.
+type TemplateConfig struct {
+	Title   string `toml:"title"`
+	Comment string `toml:"comment"`
+}
+
+type DaemonConfig struct {
+	Interval time.Duration `toml:"interval"`
+	Jitter   time.Duration `toml:"jitter"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		StateFile:      "hnbot-state.json",
+		StateRetention: 90 * 24 * time.Hour,
+		Reddit: RedditConfig{
+			Subreddit: "hackernews",
+			Agent:     "hackernews:hnmod:0.1.0",
+			Username:  "hnmod",
+			ClientID:  "v7eIyAVMwtcKG00ahocIXg",
+			Timeout:   30 * time.Second,
+			TokenURL:  "https://www.reddit.com/api/v1/access_token",
+			APIURL:    "https://oauth.reddit.com",
+		},
+		Feed: FeedConfig{
+			Sources:           []string{SOURCE_HNRSS, SOURCE_FIREBASE, SOURCE_ALGOLIA},
+			Protocol:          "https",
+			BaseURL:           "hnrss.org",
+			Name:              "frontpage",
+			Count:             50,
+			PointsThreshold:   100,
+			CommentsThreshold: 10,
+			Timeout:           120 * time.Second,
+			FirebaseURL:       "https://hacker-news.firebaseio.com/v0",
+			FirebaseList:      FIREBASE_TOP_STORIES,
+			Workers:           8,
+			AlgoliaURL:        "https://hn.algolia.com/api/v1",
+		},
+		Dedupe: DedupeConfig{
+			CheckHours:     48,
+			TitleThreshold: DEFAULT_TITLE_THRESHOLD,
+		},
+		Resolve: ResolveConfig{
+			Hosts: []string{
+				"t.co", "bit.ly", "lnkd.in", "buff.ly", "ow.ly", "tinyurl.com",
+				"goo.gl", "dlvr.it", "trib.al", "fb.me", "amzn.to", "is.gd",
+				"rebrand.ly", "shorturl.at", "flip.it", "apple.co", "wp.me",
+			},
+			Timeout:      10 * time.Second,
+			MaxRedirects: 5,
+		},
+		Canonical: CanonicalConfig{
+			Timeout:  15 * time.Second,
+			CacheTTL: 24 * time.Hour,
+		},
+		History: HistoryConfig{
+			Enabled:     true,
+			MinComments: 10,
+			MaxResults:  5,
+			Timeout:     10 * time.Second,
+			CacheTTL:    6 * time.Hour,
+		},
+		Comment: CommentConfig{
+			Sticky:      true,
+			RetrySticky: true,
+			RefreshFor:  24 * time.Hour,
+		},
+		Daemon: DaemonConfig{
+			Interval: 15 * time.Minute,
+			Jitter:   2 * time.Minute,
+		},
+	}
+}
+
+// loadConfig builds the configuration for the named subcommand from
+// defaults, the config file, the environment and args. It returns any
+// positional arguments left over after flag parsing.
+func loadConfig(name string, args []string) (*Config, []string, error) {
+	var overrides []func(*Config)
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to TOML config file (default "+DEFAULT_CONFIG_FILE+" if present, or $HNBOT_CONFIG)")
+	stringFlag(fs, &overrides, "state", "path to the local state file", func(c *Config, v string) { c.StateFile = v })
+	boolFlag(fs, &overrides, "dry-run", "decide what to post but never write to Reddit; prints a plan", func(c *Config, v bool) { c.DryRun = v })
+	boolFlag(fs, &overrides, "json", "write the dry-run plan as JSON", func(c *Config, v bool) { c.PlanJSON = v })
+	stringFlag(fs, &overrides, "plan-file", "write the dry-run plan to this file instead of stdout", func(c *Config, v string) { c.PlanFile = v })
+	stringFlag(fs, &overrides, "subreddit", "subreddit to post to", func(c *Config, v string) { c.Reddit.Subreddit = v })
+	stringFlag(fs, &overrides, "sources", "comma-separated story sources in fallback order (hnrss, firebase, algolia)", func(c *Config, v string) { c.Feed.Sources = splitList(v) })
+	stringFlag(fs, &overrides, "feed", "hnrss feed name", func(c *Config, v string) { c.Feed.Name = v })
+	intFlag(fs, &overrides, "count", "number of feed items to fetch", func(c *Config, v int) { c.Feed.Count = v })
+	intFlag(fs, &overrides, "points", "minimum HN points", func(c *Config, v int) { c.Feed.PointsThreshold = v })
+	intFlag(fs, &overrides, "comments", "minimum HN comments", func(c *Config, v int) { c.Feed.CommentsThreshold = v })
+	intFlag(fs, &overrides, "duplicate-hours", "how far back listings are checked for duplicates", func(c *Config, v int) { c.Dedupe.CheckHours = v })
+	floatFlag(fs, &overrides, "title-threshold", "title similarity score (0-1) at which stories count as duplicates", func(c *Config, v float64) { c.Dedupe.TitleThreshold = v })
+	boolFlag(fs, &overrides, "resolve", "follow shortened links before dedupe", func(c *Config, v bool) { c.Resolve.Enabled = v })
+	boolFlag(fs, &overrides, "canonical", "use rel=canonical / og:url when deduping", func(c *Config, v bool) { c.Canonical.Enabled = v })
+	boolFlag(fs, &overrides, "history", "list previous HN discussions in the bot comment", func(c *Config, v bool) { c.History.Enabled = v })
+	boolFlag(fs, &overrides, "sticky", "distinguish and sticky the HN discussion comment", func(c *Config, v bool) { c.Comment.Sticky = v })
+	boolFlag(fs, &overrides, "flair", "set link flair on new posts from flair.rules", func(c *Config, v bool) { c.Flair.Enabled = v })
+	durationFlag(fs, &overrides, "interval", "daemon: time between feed polls", func(c *Config, v time.Duration) { c.Daemon.Interval = v })
+	durationFlag(fs, &overrides, "jitter", "daemon: maximum random delay added to each interval", func(c *Config, v time.Duration) { c.Daemon.Jitter = v })
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := defaultConfig()
+
+	path := *configPath
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv("HNBOT_CONFIG")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = DEFAULT_CONFIG_FILE
+	}
+
+	if err := cfg.loadFile(path, explicit); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.applyEnv(os.Getenv); err != nil {
+		return nil, nil, err
+	}
+
+	for _, override := range overrides {
+		override(cfg)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// loadFile merges the TOML file at path into c. A missing file is only an
+// error when the path was asked for explicitly.
+func (c *Config) loadFile(path string, required bool) error {
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	md, err := toml.DecodeFile(path, c)
+	if err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return fmt.Errorf("unknown keys in config %s: %s", path, strings.Join(keys, ", "))
+	}
+
+	logger.Println("Loaded config from", path)
+
+	return nil
+}
+
+func (c *Config) applyEnv(getenv func(string) string) error {
+	var errs []error
+
+	str := func(dst *string, key string) {
+		if v := getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	num := func(dst *int, key string) {
+		if v := getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a number", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	float := func(dst *float64, key string) {
+		if v := getenv(key); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a number", key, v))
+				return
+			}
+			*dst = f
+		}
+	}
+	boolean := func(dst *bool, key string) {
+		if v := getenv(key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", key, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	dur := func(dst *time.Duration, key string) {
+		if v := getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration", key, v))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	str(&c.StateFile, "HNBOT_STATE_FILE")
+	dur(&c.StateRetention, "HNBOT_STATE_RETENTION")
+	boolean(&c.DryRun, "HNBOT_DRY_RUN")
+	str(&c.Reddit.Subreddit, "HNBOT_REDDIT_SUBREDDIT")
+	str(&c.Reddit.Agent, "HNBOT_REDDIT_AGENT")
+	str(&c.Reddit.Username, "HNBOT_REDDIT_USERNAME")
+	str(&c.Reddit.ClientID, "HNBOT_REDDIT_ID")
+	str(&c.Reddit.Secret, "REDDIT_SECRET")
+	str(&c.Reddit.Password, "REDDIT_PASSWORD")
+	str(&c.Reddit.RefreshToken, "REDDIT_REFRESH_TOKEN")
+	dur(&c.Reddit.Timeout, "HNBOT_REDDIT_TIMEOUT")
+	if v := getenv("HNBOT_FEED_SOURCES"); v != "" {
+		c.Feed.Sources = splitList(v)
+	}
+	str(&c.Feed.Protocol, "HNBOT_FEED_PROTOCOL")
+	str(&c.Feed.BaseURL, "HNBOT_FEED_BASE_URL")
+	str(&c.Feed.Name, "HNBOT_FEED_NAME")
+	num(&c.Feed.Count, "HNBOT_FEED_COUNT")
+	num(&c.Feed.PointsThreshold, "HNBOT_HN_POINTS_THRESHOLD")
+	num(&c.Feed.CommentsThreshold, "HNBOT_HN_COMMENTS_THRESHOLD")
+	dur(&c.Feed.Timeout, "HNBOT_FEED_TIMEOUT")
+	str(&c.Feed.FirebaseURL, "HNBOT_FIREBASE_URL")
+	str(&c.Feed.FirebaseList, "HNBOT_FIREBASE_LIST")
+	num(&c.Feed.Workers, "HNBOT_FEED_WORKERS")
+	str(&c.Feed.AlgoliaURL, "HNBOT_ALGOLIA_URL")
+	num(&c.Dedupe.CheckHours, "HNBOT_DUPLICATE_CHECK_HOURS")
+	float(&c.Dedupe.TitleThreshold, "HNBOT_TITLE_THRESHOLD")
+	boolean(&c.Resolve.Enabled, "HNBOT_RESOLVE_ENABLED")
+	boolean(&c.Canonical.Enabled, "HNBOT_CANONICAL_ENABLED")
+	boolean(&c.History.Enabled, "HNBOT_HISTORY_ENABLED")
+	num(&c.History.MinComments, "HNBOT_HISTORY_MIN_COMMENTS")
+	boolean(&c.Comment.Sticky, "HNBOT_COMMENT_STICKY")
+	boolean(&c.Comment.RetrySticky, "HNBOT_COMMENT_RETRY_STICKY")
+	dur(&c.Comment.RefreshFor, "HNBOT_COMMENT_REFRESH_FOR")
+	boolean(&c.Title.Markers, "HNBOT_TITLE_MARKERS")
+	str(&c.Templates.Title, "HNBOT_TITLE_TEMPLATE")
+	str(&c.Templates.Comment, "HNBOT_COMMENT_TEMPLATE")
+	boolean(&c.Flair.Enabled, "HNBOT_FLAIR_ENABLED")
+	dur(&c.Daemon.Interval, "HNBOT_DAEMON_INTERVAL")
+	dur(&c.Daemon.Jitter, "HNBOT_DAEMON_JITTER")
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) validate() error {
+	var errs []error
+
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"state_file", c.StateFile},
+		{"reddit.subreddit", c.Reddit.Subreddit},
+		{"reddit.agent", c.Reddit.Agent},
+		{"reddit.username", c.Reddit.Username},
+		{"reddit.client_id", c.Reddit.ClientID},
+		{"feed.base_url", c.Feed.BaseURL},
+		{"feed.name", c.Feed.Name},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", r.name))
+		}
+	}
+
+	if c.Reddit.Secret == "" {
+		errs = append(errs, errors.New("no Reddit secret provided in environment variable REDDIT_SECRET"))
+	}
+	if c.Reddit.Password == "" {
+		errs = append(errs, errors.New("no Reddit password provided in environment variable REDDIT_PASSWORD"))
+	}
+
+	if strings.HasPrefix(c.Reddit.Subreddit, "r/") || strings.HasPrefix(c.Reddit.Subreddit, "/r/") {
+		errs = append(errs, fmt.Errorf("reddit.subreddit %q should not include the r/ prefix", c.Reddit.Subreddit))
+	}
+	if c.Reddit.Timeout <= 0 {
+		errs = append(errs, errors.New("reddit.timeout must be positive"))
+	}
+
+	if len(c.Feed.Sources) == 0 {
+		errs = append(errs, errors.New("feed.sources must list at least one source"))
+	}
+	for _, name := range c.Feed.Sources {
+		switch name {
+		case SOURCE_HNRSS, SOURCE_FIREBASE, SOURCE_ALGOLIA:
+		default:
+			errs = append(errs, fmt.Errorf("feed.sources: unknown source %q (expected hnrss, firebase or algolia)", name))
+		}
+	}
+	for i, f := range c.Feed.Feeds {
+		name := fmt.Sprintf("feed.feeds[%d]", i)
+		if strings.TrimSpace(f.Name) == "" {
+			errs = append(errs, fmt.Errorf("%s.name is required", name))
+		}
+		if strings.ContainsAny(f.Name, "?&") {
+			errs = append(errs, fmt.Errorf("%s.name %q should not include a query; use query instead", name, f.Name))
+		}
+		if f.PointsThreshold != nil && *f.PointsThreshold < 0 {
+			errs = append(errs, fmt.Errorf("%s.points_threshold must not be negative", name))
+		}
+		if f.CommentsThreshold != nil && *f.CommentsThreshold < 0 {
+			errs = append(errs, fmt.Errorf("%s.comments_threshold must not be negative", name))
+		}
+		if f.MaxAge < 0 {
+			errs = append(errs, fmt.Errorf("%s.max_age must not be negative", name))
+		}
+		if strings.HasPrefix(f.Subreddit, "r/") || strings.HasPrefix(f.Subreddit, "/r/") {
+			errs = append(errs, fmt.Errorf("%s.subreddit %q should not include the r/ prefix", name, f.Subreddit))
+		}
+	}
+	if c.Feed.FirebaseList != FIREBASE_TOP_STORIES && c.Feed.FirebaseList != FIREBASE_BEST_STORIES {
+		errs = append(errs, fmt.Errorf("feed.firebase_list must be %s or %s, got %q", FIREBASE_TOP_STORIES, FIREBASE_BEST_STORIES, c.Feed.FirebaseList))
+	}
+	if c.Feed.Workers < 1 {
+		errs = append(errs, errors.New("feed.workers must be at least 1"))
+	}
+	if c.Feed.Protocol != "http" && c.Feed.Protocol != "https" {
+		errs = append(errs, fmt.Errorf("feed.protocol must be http or https, got %q", c.Feed.Protocol))
+	}
+	if c.Feed.Count < 1 || c.Feed.Count > 100 {
+		errs = append(errs, fmt.Errorf("feed.count must be between 1 and 100, got %d", c.Feed.Count))
+	}
+	if c.Feed.PointsThreshold < 0 {
+		errs = append(errs, errors.New("feed.points_threshold must not be negative"))
+	}
+	if c.Feed.CommentsThreshold < 0 {
+		errs = append(errs, errors.New("feed.comments_threshold must not be negative"))
+	}
+	if c.Feed.Timeout <= 0 {
+		errs = append(errs, errors.New("feed.timeout must be positive"))
+	}
+
+	if c.Dedupe.CheckHours <= 0 {
+		errs = append(errs, errors.New("dedupe.check_hours must be positive"))
+	}
+	if c.StateRetention < 0 {
+		errs = append(errs, errors.New("state_retention must not be negative"))
+	} else if window := time.Duration(c.Dedupe.CheckHours) * time.Hour; c.StateRetention > 0 && c.StateRetention < window {
+		errs = append(errs, fmt.Errorf("state_retention (%v) must be at least the dedupe window (%v)", c.StateRetention, window))
+	}
+	if c.Dedupe.TitleThreshold <= 0 || c.Dedupe.TitleThreshold > 1 {
+		errs = append(errs, fmt.Errorf("dedupe.title_threshold must be in (0, 1], got %v", c.Dedupe.TitleThreshold))
+	}
+
+	if c.Resolve.Enabled {
+		if c.Resolve.Timeout <= 0 {
+			errs = append(errs, errors.New("resolve.timeout must be positive"))
+		}
+		if c.Resolve.MaxRedirects < 1 {
+			errs = append(errs, errors.New("resolve.max_redirects must be at least 1"))
+		}
+	}
+
+	if c.Canonical.Enabled {
+		if c.Canonical.Timeout <= 0 {
+			errs = append(errs, errors.New("canonical.timeout must be positive"))
+		}
+		if c.Canonical.CacheTTL < 0 {
+			errs = append(errs, errors.New("canonical.cache_ttl must not be negative"))
+		}
+	}
+
+	if c.History.Enabled {
+		if c.History.Timeout <= 0 {
+			errs = append(errs, errors.New("history.timeout must be positive"))
+		}
+		if c.History.CacheTTL < 0 {
+			errs = append(errs, errors.New("history.cache_ttl must not be negative"))
+		}
+		if c.History.MaxResults < 1 {
+			errs = append(errs, errors.New("history.max_results must be at least 1"))
+		}
+		if c.History.MinComments < 0 {
+			errs = append(errs, errors.New("history.min_comments must not be negative"))
+		}
+	}
+
+	for i, r := range c.Routes {
+		name := fmt.Sprintf("routes[%d]", i)
+		if len(r.Subreddits) == 0 {
+			errs = append(errs, fmt.Errorf("%s.subreddits must list at least one subreddit", name))
+		}
+		errs = append(errs, validateSubreddits(name, r.Subreddits)...)
+		errs = append(errs, r.StoryMatch.validate(name)...)
+	}
+
+	if c.Flair.Enabled {
+		for i, r := range c.Flair.Rules {
+			name := fmt.Sprintf("flair.rules[%d]", i)
+			if r.TemplateID == "" && r.Text == "" {
+				errs = append(errs, fmt.Errorf("%s needs a template_id or text", name))
+			}
+			if _, ok := c.Flair.Categories[r.Category]; r.Category != "" && !ok {
+				errs = append(errs, fmt.Errorf("%s.category: no category %q in flair.categories", name, r.Category))
+			}
+			errs = append(errs, validateSubreddits(name, r.Subreddits)...)
+			errs = append(errs, r.StoryMatch.validate(name)...)
+		}
+	}
+
+	if _, err := newTemplates(c); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Comment.RefreshFor < 0 {
+		errs = append(errs, errors.New("comment.refresh_for must not be negative"))
+	}
+
+	if c.Daemon.Interval <= 0 {
+		errs = append(errs, errors.New("daemon.interval must be positive"))
+	}
+	if c.Daemon.Jitter < 0 {
+		errs = append(errs, errors.New("daemon.jitter must not be negative"))
+	}
+	if c.Daemon.Jitter >= c.Daemon.Interval {
+		errs = append(errs, fmt.Errorf("daemon.jitter (%v) must be smaller than daemon.interval (%v)", c.Daemon.Jitter, c.Daemon.Interval))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m StoryMatch) validate(name string) []error {
+	var errs []error
+	for _, t := range m.Types {
+		switch strings.ToLower(t) {
+		case STORY_TYPE_STORY, STORY_TYPE_ASK, STORY_TYPE_SHOW, STORY_TYPE_TELL, STORY_TYPE_LAUNCH, STORY_TYPE_JOB, STORY_TYPE_POLL:
+		default:
+			errs = append(errs, fmt.Errorf("%s.types: unknown story type %q", name, t))
+		}
+	}
+	if _, err := regexp.Compile(m.Keyword); err != nil {
+		errs = append(errs, fmt.Errorf("%s.keyword: %w", name, err))
+	}
+	return errs
+}
+
+func validateSubreddits(name string, subs []string) []error {
+	var errs []error
+	for _, sub := range subs {
+		if strings.TrimSpace(sub) == "" || strings.HasPrefix(sub, "r/") || strings.HasPrefix(sub, "/r/") {
+			errs = append(errs, fmt.Errorf("%s.subreddits: %q is not a bare subreddit name", name, sub))
+		}
+	}
+	return errs
+}
+
+// splitList parses a comma-separated list, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func stringFlag(fs *flag.FlagSet, overrides *[]func(*Config), name, usage string, set func(*Config, string)) {
+	fs.Func(name, usage, func(v string) error {
+		*overrides = append(*overrides, func(c *Config) { set(c, v) })
+		return nil
+	})
+}
+
+func intFlag(fs *flag.FlagSet, overrides *[]func(*Config), name, usage string, set func(*Config, int)) {
+	fs.Func(name, usage, func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+		*overrides = append(*overrides, func(c *Config) { set(c, n) })
+		return nil
+	})
+}
+
+func floatFlag(fs *flag.FlagSet, overrides *[]func(*Config), name, usage string, set func(*Config, float64)) {
+	fs.Func(name, usage, func(v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+		*overrides = append(*overrides, func(c *Config) { set(c, f) })
+		return nil
+	})
+}
+
+func boolFlag(fs *flag.FlagSet, overrides *[]func(*Config), name, usage string, set func(*Config, bool)) {
+	fs.BoolFunc(name, usage, func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", v)
+		}
+		*overrides = append(*overrides, func(c *Config) { set(c, b) })
+		return nil
+	})
+}
+
+func durationFlag(fs *flag.FlagSet, overrides *[]func(*Config), name, usage string, set func(*Config, time.Duration)) {
+	fs.Func(name, usage, func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", v)
+		}
+		*overrides = append(*overrides, func(c *Config) { set(c, d) })
+		return nil
+	})
+}
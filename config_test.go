@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigLayering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hnbot.toml")
+	err := os.WriteFile(path, []byte(`
+[reddit]
+subreddit = "fromfile"
+
+[feed]
+points_threshold = 250
+comments_threshold = 20
+
+[daemon]
+interval = "30m"
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("REDDIT_SECRET", "secret")
+	t.Setenv("REDDIT_PASSWORD", "password")
+	t.Setenv("HNBOT_HN_POINTS_THRESHOLD", "300")
+
+	cfg, rest, err := loadConfig("run", []string{"-config", path, "-comments", "5", "extra"})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	if cfg.Reddit.Subreddit != "fromfile" {
+		t.Errorf("subreddit = %q, want value from file", cfg.Reddit.Subreddit)
+	}
+	if cfg.Feed.PointsThreshold != 300 {
+		t.Errorf("points = %d, want env override 300", cfg.Feed.PointsThreshold)
+	}
+	if cfg.Feed.CommentsThreshold != 5 {
+		t.Errorf("comments = %d, want flag override 5", cfg.Feed.CommentsThreshold)
+	}
+	if cfg.Daemon.Interval != 30*time.Minute {
+		t.Errorf("interval = %v, want 30m", cfg.Daemon.Interval)
+	}
+	if cfg.Feed.Name != "frontpage" {
+		t.Errorf("feed name = %q, want default", cfg.Feed.Name)
+	}
+	if len(rest) != 1 || rest[0] != "extra" {
+		t.Errorf("remaining args = %v, want [extra]", rest)
+	}
+
+	if got := buildFeedUrl(cfg, cfg.hnrssFeeds()[0]).String(); got != "https://hnrss.org/frontpage?comments=5&count=50&points=300" {
+		t.Errorf("buildFeedUrl = %q", got)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	unknown := filepath.Join(dir, "unknown.toml")
+	if err := os.WriteFile(unknown, []byte("[feed]\npoints = 10\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	badFlair := filepath.Join(dir, "flair.toml")
+	if err := os.WriteFile(badFlair, []byte("[flair]\nenabled = true\n[[flair.rules]]\ncategory = \"video\"\ntext = \"Video\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "Missing secret",
+			env:     map[string]string{"REDDIT_SECRET": ""},
+			wantErr: "REDDIT_SECRET",
+		},
+		{
+			name:    "Missing explicit config file",
+			args:    []string{"-config", filepath.Join(dir, "nope.toml")},
+			wantErr: "failed to read config",
+		},
+		{
+			name:    "Unknown key",
+			args:    []string{"-config", unknown},
+			wantErr: "feed.points",
+		},
+		{
+			name:    "Jitter larger than interval",
+			args:    []string{"-interval", "1m", "-jitter", "5m"},
+			wantErr: "daemon.jitter",
+		},
+		{
+			name:    "Bad env number",
+			env:     map[string]string{"HNBOT_FEED_COUNT": "lots"},
+			wantErr: "HNBOT_FEED_COUNT",
+		},
+		{
+			name:    "Count out of range",
+			args:    []string{"-count", "500"},
+			wantErr: "feed.count",
+		},
+		{
+			name:    "Flair rule with unknown category",
+			args:    []string{"-config", badFlair},
+			wantErr: "flair.rules[0].category",
+		},
+		{
+			name:    "Retention shorter than dedupe window",
+			env:     map[string]string{"HNBOT_STATE_RETENTION": "24h"},
+			wantErr: "state_retention",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Chdir(dir)
+			t.Setenv("REDDIT_SECRET", "s")
+			t.Setenv("REDDIT_PASSWORD", "p")
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			_, _, err := loadConfig("run", tc.args)
+			if err == nil {
+				t.Fatalf("expected error containing %q", tc.wantErr)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("error %q does not mention %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFeeds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hnbot.toml")
+	err := os.WriteFile(path, []byte(`
+[[feed.feeds]]
+name = "frontpage"
+
+[[feed.feeds]]
+name = "show"
+points_threshold = 0
+max_age = "12h"
+subreddit = "showhn"
+
+[[feed.feeds]]
+name = "newest"
+query = "golang"
+comments_threshold = 50
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("REDDIT_SECRET", "secret")
+	t.Setenv("REDDIT_PASSWORD", "password")
+
+	cfg, _, err := loadConfig("run", []string{"-config", path})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	feeds := cfg.hnrssFeeds()
+	if len(feeds) != 3 {
+		t.Fatalf("got %d feeds, want 3", len(feeds))
+	}
+
+	want := []string{
+		"https://hnrss.org/frontpage?comments=10&count=50&points=100",
+		"https://hnrss.org/show?comments=10&count=50&points=0",
+		"https://hnrss.org/newest?comments=50&count=50&points=100&q=golang",
+	}
+	for i, f := range feeds {
+		if got := buildFeedUrl(cfg, f).String(); got != want[i] {
+			t.Errorf("feed %d URL = %q, want %q", i, got, want[i])
+		}
+	}
+
+	if feeds[1].MaxAge != 12*time.Hour || feeds[1].Subreddit != "showhn" {
+		t.Errorf("unexpected show feed: %+v", feeds[1])
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runDaemon keeps a single logged in bot alive and processes the feed on
+// the configured interval until SIGINT or SIGTERM is received.
+func runDaemon(cfg *Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Printf("Starting daemon (interval %v, jitter up to %v)\n", cfg.Daemon.Interval, cfg.Daemon.Jitter)
+
+	app, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	return app.daemon(ctx)
+}
+
+// daemon runs the feed on the configured interval until ctx is done, then
+// saves the store.
+func (a *App) daemon(ctx context.Context) error {
+	for {
+		if err := a.runOnce(ctx); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			logger.Printf("Run failed: %v\n", err)
+		}
+
+		wait := nextPoll(a.cfg.Daemon.Interval, a.cfg.Daemon.Jitter)
+		logger.Printf("Next poll in %v\n", wait.Round(time.Second))
+		if !sleepContext(ctx, wait) {
+			break
+		}
+	}
+
+	logger.Println("Shutting down")
+
+	if err := a.store.Save(); err != nil {
+		return fmt.Errorf("error saving store on shutdown: %w", err)
+	}
+
+	return nil
+}
+
+// runOnce fetches stories from the source and processes them, pruning
+// old store entries, retrying comment stickies that failed before and
+// refreshing the stats in recent comments. In dry-run mode it collects a
+// fresh Plan and writes it out instead of posting.
+func (a *App) runOnce(ctx context.Context) error {
+	stories, err := getStoriesWithRetry(ctx, a.source)
+	if err != nil {
+		return err
+	}
+
+	if !a.cfg.DryRun {
+		a.pruneStore()
+		a.retryStickies(ctx)
+		err := a.processFeed(ctx, stories)
+		a.refreshComments(ctx, stories)
+		return err
+	}
+
+	a.plan = &Plan{}
+	defer func() { a.plan = nil }()
+
+	if err := a.processFeed(ctx, stories); err != nil {
+		return err
+	}
+	return writePlan(a.cfg, a.plan)
+}
+
+// pruneStore drops store entries older than state_retention.
+func (a *App) pruneStore() {
+	if a.cfg.StateRetention <= 0 {
+		return
+	}
+	if n := a.store.Prune(time.Now().Add(-a.cfg.StateRetention)); n > 0 {
+		logger.Printf("Pruned %d old entries from the store\n", n)
+	}
+}
+
+// nextPoll is interval plus a random delay in [0, jitter).
+func nextPoll(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + rand.N(jitter)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/turnage/graw/reddit"
+)
+
+func TestNextPoll(t *testing.T) {
+	testCases := []struct {
+		name     string
+		interval time.Duration
+		jitter   time.Duration
+	}{
+		{name: "No jitter", interval: 15 * time.Minute},
+		{name: "Negative jitter", interval: 15 * time.Minute, jitter: -time.Minute},
+		{name: "Jitter", interval: 15 * time.Minute, jitter: 2 * time.Minute},
+		{name: "Tiny jitter", interval: time.Minute, jitter: time.Nanosecond},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for range 1000 {
+				got := nextPoll(tc.interval, tc.jitter)
+				if got < tc.interval || got >= tc.interval+max(tc.jitter, time.Nanosecond) {
+					t.Fatalf("nextPoll(%v, %v) = %v, want in [interval, interval+jitter)", tc.interval, tc.jitter, got)
+				}
+			}
+		})
+	}
+}
+
+// runSource reports each run on runs and returns no stories.
+type runSource struct {
+	runs chan struct{}
+}
+
+func (s runSource) Name() string {
+	return "test"
+}
+
+func (s runSource) Stories(ctx context.Context) ([]Story, error) {
+	s.runs <- struct{}{}
+	return nil, nil
+}
+
+func TestDaemonStopsOnCancel(t *testing.T) {
+	app := newTestApp(t, nil)
+	runs := make(chan struct{}, 1)
+	app.source = runSource{runs: runs}
+	app.cfg.Daemon.Interval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.daemon(ctx) }()
+
+	// Cancel while the daemon waits for the next poll.
+	<-runs
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("daemon: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon didn't stop after its context was cancelled")
+	}
+}
+
+// cancelBot cancels the run as soon as a post is submitted, like a
+// shutdown signal arriving mid-post.
+type cancelBot struct {
+	routedBot
+	cancel context.CancelFunc
+}
+
+func (b *cancelBot) GetPostLink(subreddit, title, url string) (reddit.Submission, error) {
+	b.cancel()
+	return b.routedBot.GetPostLink(subreddit, title, url)
+}
+
+func TestShutdownFinishesPost(t *testing.T) {
+	app := newTestApp(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bot := &cancelBot{cancel: cancel}
+	app.bot = bot
+
+	var distinguished atomic.Bool
+	app.api = newTestRedditClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/access_token":
+			fmt.Fprint(w, `{"access_token":"tok","expires_in":3600}`)
+			return
+		case "/api/distinguish":
+			distinguished.Store(true)
+		}
+		fmt.Fprint(w, `{}`)
+	})
+
+	now := time.Now()
+	stories := []Story{
+		{ID: 1, Title: "First story", URL: "https://example.com/1", Time: now},
+		{ID: 2, Title: "Second story", URL: "https://example.com/2", Time: now},
+	}
+	if err := app.processFeed(ctx, stories); err != nil {
+		t.Fatalf("processFeed: %v", err)
+	}
+
+	// The post that was going when ctx was cancelled gets its comment,
+	// stickied; the next story isn't started.
+	if !slices.Equal(bot.submitted, []string{"hackernews"}) {
+		t.Errorf("submitted to %q, want only the first story posted", bot.submitted)
+	}
+	if _, p, ok := app.store.FindPostedHN(1, "hackernews"); !ok || p.Comment == "" || !p.Stickied {
+		t.Errorf("stored post = %+v, want its comment posted and stickied", p)
+	}
+	if !distinguished.Load() {
+		t.Error("comment wasn't distinguished after the cancel")
+	}
+}
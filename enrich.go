@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// CANONICAL_MAX_BODY caps how much of a page is read looking for
+// canonical tags. They live in <head>, so the start of the page is enough.
+const CANONICAL_MAX_BODY = 512 * 1024
+
+// CanonicalFetcher looks up the publisher's own idea of an article's URL
+// from <link rel="canonical"> or og:url, so AMP, mobile, print and
+// syndicated copies dedupe against each other. Results are cached in the
+// store. A nil CanonicalFetcher leaves every URL as it is.
+type CanonicalFetcher struct {
+	client  *http.Client
+	store   *Store
+	agent   string
+	timeout time.Duration
+	ttl     time.Duration
+	ignore  map[string]bool
+}
+
+// newCanonicalFetcher returns nil when canonical lookups are disabled.
+func newCanonicalFetcher(cfg *Config, client *http.Client, st *Store) *CanonicalFetcher {
+	if !cfg.Canonical.Enabled {
+		return nil
+	}
+
+	ignore := make(map[string]bool, len(cfg.Canonical.IgnoreDomains))
+	for _, d := range cfg.Canonical.IgnoreDomains {
+		ignore[strings.TrimPrefix(strings.ToLower(d), "www.")] = true
+	}
+
+	return &CanonicalFetcher{
+		client:  client,
+		store:   st,
+		agent:   cfg.Reddit.Agent,
+		timeout: cfg.Canonical.Timeout,
+		ttl:     cfg.Canonical.CacheTTL,
+		ignore:  ignore,
+	}
+}
+
+// shouldFetch skips non-web URLs, opted-out domains, HN itself and sites
+// whose URLs are already canonicalized offline.
+func (c *CanonicalFetcher) shouldFetch(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if host == HN_BASE_URL {
+		return false
+	}
+
+	if _, ok := canonicalizerFor(host); ok {
+		return false
+	}
+
+	for _, h := range parentDomains(host) {
+		if c.ignore[h] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Canonical returns the canonical URL the page at rawURL declares, or
+// rawURL itself if there is none or it can't be trusted.
+func (c *CanonicalFetcher) Canonical(ctx context.Context, rawURL string) string {
+	if c == nil || rawURL == "" {
+		return rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || !c.shouldFetch(u) {
+		return rawURL
+	}
+
+	if cached, ok := c.store.Canonical(rawURL); ok {
+		if cached.Canonical != "" {
+			return cached.Canonical
+		}
+		if time.Since(cached.FetchedAt) < c.ttl {
+			return rawURL
+		}
+	}
+
+	canonical, err := c.fetch(ctx, u)
+	if err != nil {
+		logger.Printf("Warning: failed to fetch canonical URL for %s: %v\n", rawURL, err)
+	}
+
+	if canonical != "" && canonical != rawURL {
+		logger.Printf("Canonical URL for %s is %s\n", rawURL, canonical)
+	}
+
+	c.store.SetCanonical(rawURL, canonical)
+
+	if canonical == "" {
+		return rawURL
+	}
+	return canonical
+}
+
+func (c *CanonicalFetcher) fetch(ctx context.Context, u *url.URL) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", c.agent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("GET returned %s", resp.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", nil
+	}
+
+	canonical, err := extractCanonical(resp.Request.URL, io.LimitReader(resp.Body, CANONICAL_MAX_BODY))
+	if err != nil {
+		return "", err
+	}
+
+	if canonical == nil || !plausibleCanonical(u, canonical) {
+		return "", nil
+	}
+
+	return canonical.String(), nil
+}
+
+// extractCanonical reads <link rel="canonical">, falling back to og:url.
+// Relative references are resolved against base.
+func extractCanonical(base *url.URL, r io.Reader) (*url.URL, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page: %w", err)
+	}
+
+	var candidates []string
+	if href, ok := doc.Find(`link[rel~="canonical"]`).First().Attr("href"); ok {
+		candidates = append(candidates, href)
+	}
+	if content, ok := doc.Find(`meta[property="og:url"]`).First().Attr("content"); ok {
+		candidates = append(candidates, content)
+	}
+
+	for _, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "" {
+			continue
+		}
+		ref, err := url.Parse(candidate)
+		if err != nil {
+			continue
+		}
+		resolved := base.ResolveReference(ref)
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			continue
+		}
+		return resolved, nil
+	}
+
+	return nil, nil
+}
+
+// plausibleCanonical rejects the most common lie: an article claiming the
+// site's homepage as its canonical URL.
+func plausibleCanonical(orig, canonical *url.URL) bool {
+	if canonical.Host == "" {
+		return false
+	}
+	origRoot := strings.Trim(orig.Path, "/") == ""
+	canonicalRoot := strings.Trim(canonical.Path, "/") == ""
+	return origRoot || !canonicalRoot
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/turnage/graw/reddit"
+)
+
+func TestExtractCanonical(t *testing.T) {
+	base := mustParse(t, "https://amp.example.com/story/123/amp")
+
+	testCases := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "Link rel canonical",
+			html:     `<html><head><link rel="canonical" href="https://example.com/story/123"></head></html>`,
+			expected: "https://example.com/story/123",
+		},
+		{
+			name:     "Canonical among other rel tokens",
+			html:     `<link rel="alternate canonical" href="https://example.com/story/123">`,
+			expected: "https://example.com/story/123",
+		},
+		{
+			name:     "Relative canonical",
+			html:     `<link rel="canonical" href="/story/123">`,
+			expected: "https://amp.example.com/story/123",
+		},
+		{
+			name:     "og:url fallback",
+			html:     `<meta property="og:url" content="https://example.com/story/123">`,
+			expected: "https://example.com/story/123",
+		},
+		{
+			name:     "Canonical wins over og:url",
+			html:     `<meta property="og:url" content="https://example.com/og"><link rel="canonical" href="https://example.com/canonical">`,
+			expected: "https://example.com/canonical",
+		},
+		{
+			name:     "Nothing declared",
+			html:     `<html><head><title>hi</title></head></html>`,
+			expected: "",
+		},
+		{
+			name:     "Non-web scheme ignored",
+			html:     `<link rel="canonical" href="javascript:alert(1)">`,
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := extractCanonical(base, strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatalf("extractCanonical: %v", err)
+			}
+			gotStr := ""
+			if got != nil {
+				gotStr = got.String()
+			}
+			if gotStr != tc.expected {
+				t.Errorf("extractCanonical = %q, want %q", gotStr, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCanonicalFetcher(t *testing.T) {
+	var srvURL string
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/amp/story":
+			fmt.Fprintf(w, `<link rel="canonical" href="%s/story">`, srvURL)
+		case "/liar":
+			fmt.Fprintf(w, `<link rel="canonical" href="%s/">`, srvURL)
+		default:
+			fmt.Fprint(w, `<p>no canonical</p>`)
+		}
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	cfg := defaultConfig()
+	cfg.Canonical.Enabled = true
+	c := newCanonicalFetcher(cfg, newHTTPClient(cfg), st)
+	ctx := context.Background()
+
+	if got, want := c.Canonical(ctx, srv.URL+"/amp/story"), srv.URL+"/story"; got != want {
+		t.Errorf("Canonical = %q, want %q", got, want)
+	}
+	c.Canonical(ctx, srv.URL+"/amp/story")
+	if hits["/amp/story"] != 1 {
+		t.Errorf("page fetched %d times, want 1 (should be cached)", hits["/amp/story"])
+	}
+
+	if got, want := c.Canonical(ctx, srv.URL+"/liar"), srv.URL+"/liar"; got != want {
+		t.Errorf("homepage canonical should be rejected: got %q", got)
+	}
+
+	c.Canonical(ctx, srv.URL+"/plain")
+	c.Canonical(ctx, srv.URL+"/plain")
+	if hits["/plain"] != 1 {
+		t.Errorf("page without canonical fetched %d times, want 1 within TTL", hits["/plain"])
+	}
+
+	cfg.Canonical.IgnoreDomains = []string{"127.0.0.1"}
+	ignoring := newCanonicalFetcher(cfg, newHTTPClient(cfg), st)
+	if got, want := ignoring.Canonical(ctx, srv.URL+"/other/amp"), srv.URL+"/other/amp"; got != want {
+		t.Errorf("ignored domain should be left alone: got %q", got)
+	}
+	if hits["/other/amp"] != 0 {
+		t.Error("ignored domain should not be fetched")
+	}
+
+	// The store's URL index follows the cached canonical.
+	if got, want := st.normalizeLocked(srv.URL+"/amp/story"), normalizeURL(srv.URL+"/story"); got != want {
+		t.Errorf("store identity = %q, want %q", got, want)
+	}
+}
+
+func TestExistingPostsCanonical(t *testing.T) {
+	var srvURL string
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<link rel="canonical" href="%s/canonical%s">`, srvURL, r.URL.Path)
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	now := time.Now()
+	posts := []*reddit.Post{
+		{Name: "t3_recent", URL: srv.URL + "/recent", CreatedUTC: uint64(now.Add(-time.Hour).Unix())},
+		{Name: "t3_old", URL: srv.URL + "/old", CreatedUTC: uint64(now.Add(-30 * 24 * time.Hour).Unix())},
+	}
+	app := newTestApp(t, posts)
+	app.cfg.Canonical.Enabled = true
+	app.canonical = newCanonicalFetcher(app.cfg, newHTTPClient(app.cfg), app.store)
+
+	existing, err := app.getExistingPosts(context.Background(), "hackernews")
+	if err != nil {
+		t.Fatalf("getExistingPosts: %v", err)
+	}
+
+	for _, p := range existing {
+		switch p.Name {
+		case "t3_recent":
+			if want := normalizeURL(srv.URL + "/canonical/recent"); p.NormalizedURL != want {
+				t.Errorf("recent post normalized to %q, want %q", p.NormalizedURL, want)
+			}
+		case "t3_old":
+			if want := normalizeURL(srv.URL + "/old"); p.NormalizedURL != want {
+				t.Errorf("old post normalized to %q, want %q", p.NormalizedURL, want)
+			}
+		}
+	}
+	// new, hot and top all list the recent post; it should be fetched once.
+	if hits["/recent"] != 1 {
+		t.Errorf("recent post fetched %d times, want 1", hits["/recent"])
+	}
+	if hits["/old"] != 0 {
+		t.Error("post outside the dedupe window should not be fetched")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// runExplain implements `hnbot explain <url-or-hn-id> [title]`.
+func runExplain(cfg *Config, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: hnbot explain [flags] <url-or-hn-id> [title]")
+	}
+
+	title := ""
+	if len(args) == 2 {
+		title = args[1]
+	}
+
+	app, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	return app.explain(context.Background(), os.Stdout, args[0], title)
+}
+
+// explain runs a single story through the same dedupe checks as
+// processFeed and writes out which rule, if any, would stop it.
+func (a *App) explain(ctx context.Context, w io.Writer, target, title string) error {
+	var hnID int
+	var link string
+
+	if id, err := strconv.Atoi(target); err == nil && id > 0 {
+		hnID = id
+	} else if id := hnItemID(target); id != 0 {
+		hnID = id
+	} else {
+		link = target
+	}
+
+	var sources []string
+
+	if it, ok := a.store.Find(hnID, normalizeURL(link)); ok {
+		sources = append(sources, "local store")
+		hnID = max(hnID, it.HNID)
+		if link == "" {
+			link = it.URL
+		}
+		if title == "" {
+			title = it.Title
+		}
+	}
+
+	stories, err := a.source.Stories(ctx)
+	feedOK := err == nil
+	var feedStory *Story
+	if err != nil {
+		fmt.Fprintf(w, "Warning: feed unavailable, can't tell whether the story is in it: %v\n", err)
+	} else {
+		feedStory = findFeedStory(mergeStories(stories), hnID, normalizeURL(link))
+	}
+
+	if feedStory != nil {
+		sources = append(sources, "current feed")
+		hnID = max(hnID, feedStory.ID)
+		if link == "" {
+			link = feedStory.URL
+		}
+		if title == "" {
+			title = feedStory.Title
+		}
+	}
+
+	if link == "" && hnID != 0 {
+		link = hnItemURL(hnID)
+	}
+
+	normalizedLink := a.normalize(ctx, link)
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Input:       %s\n", target)
+	if hnID != 0 {
+		fmt.Fprintf(w, "HN item:     %s\n", hnItemURL(hnID))
+	} else {
+		fmt.Fprintln(w, "HN item:     unknown")
+	}
+	fmt.Fprintf(w, "Link:        %s\n", link)
+	fmt.Fprintf(w, "Normalized:  %s\n", normalizedLink)
+	if title != "" {
+		fmt.Fprintf(w, "Title:       %s\n", title)
+	} else {
+		fmt.Fprintln(w, "Title:       unknown (title check skipped; pass it as a second argument)")
+	}
+	if len(sources) > 0 {
+		fmt.Fprintf(w, "Details from: %v\n", sources)
+	}
+
+	story := Story{ID: hnID, Title: title, URL: link, Type: storyTypeFromTitle(title)}
+	if feedStory != nil {
+		story.Type = feedStory.Type
+		story.Subreddits = feedStory.Subreddits
+	}
+
+	for _, subreddit := range a.targetsFor(story) {
+		if err := a.explainTarget(ctx, w, subreddit, hnID, normalizedLink, title); err != nil {
+			return err
+		}
+	}
+
+	if feedOK && feedStory == nil {
+		fmt.Fprintln(w, "Note: the story isn't in the current feed (below the points/comments thresholds or off the front page), so the bot won't see it yet.")
+	}
+
+	return nil
+}
+
+// explainTarget writes the dedupe verdict for posting to one subreddit.
+func (a *App) explainTarget(ctx context.Context, w io.Writer, subreddit string, hnID int, normalizedLink, title string) error {
+	existingPosts, err := a.getExistingPosts(ctx, subreddit)
+	if err != nil {
+		return fmt.Errorf("error getting existing posts from r/%s: %w", subreddit, err)
+	}
+
+	cutoffTime := time.Now().Add(-time.Duration(a.cfg.Dedupe.CheckHours) * time.Hour)
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Subreddit:   r/%s\n", subreddit)
+
+	dup := findDuplicate(a.store, subreddit, hnID, normalizedLink, title, existingPosts, cutoffTime, a.cfg.Dedupe.TitleThreshold)
+	if dup != nil {
+		fmt.Fprintln(w, "Verdict:     DUPLICATE, would be skipped")
+		fmt.Fprintf(w, "Rule:        %s\n", dup.Rule)
+		fmt.Fprintf(w, "Detail:      %s\n", dup.Detail)
+		switch {
+		case dup.Post != nil:
+			fmt.Fprintf(w, "Matched:     %q\n", dup.Post.Title)
+			fmt.Fprintf(w, "Permalink:   %s\n", dup.Post.Permalink)
+			fmt.Fprintf(w, "Age:         %s\n", time.Since(dup.Post.CreatedAt).Round(time.Minute))
+		case dup.Stored != nil:
+			fmt.Fprintf(w, "Matched:     %q\n", dup.Stored.Title)
+			fmt.Fprintf(w, "Permalink:   %s\n", redditPermalink(dup.StoredPost.Name))
+			fmt.Fprintf(w, "Age:         %s\n", time.Since(dup.StoredPost.PostedAt).Round(time.Minute))
+		}
+		return nil
+	}
+
+	fmt.Fprintln(w, "Verdict:     NOT A DUPLICATE, would be posted")
+	if hnID != 0 {
+		fmt.Fprintf(w, "  - no post for HN story %d in the store or r/%s listings\n", hnID, subreddit)
+	}
+	fmt.Fprintf(w, "  - no post with URL %s in the store or the last %dh of listings\n", normalizedLink, a.cfg.Dedupe.CheckHours)
+
+	if title != "" {
+		best, bestPost := TitleSimilarity{}, (*RedditPost)(nil)
+		for i, post := range existingPosts {
+			if post.CreatedAt.Before(cutoffTime) {
+				continue
+			}
+			if sim := compareTitles(title, post.Title); bestPost == nil || sim.Score > best.Score {
+				best, bestPost = sim, &existingPosts[i]
+			}
+		}
+		if bestPost != nil {
+			fmt.Fprintf(w, "  - closest title scores %.2f (< %.2f): %q %s\n", best.Score, a.cfg.Dedupe.TitleThreshold, bestPost.Title, bestPost.Permalink)
+		} else {
+			fmt.Fprintf(w, "  - no listing posts in the last %dh to compare titles with\n", a.cfg.Dedupe.CheckHours)
+		}
+	}
+
+	return nil
+}
+
+func findFeedStory(stories []Story, hnID int, normalizedLink string) *Story {
+	for i, story := range stories {
+		if hnID != 0 && story.ID == hnID {
+			return &stories[i]
+		}
+		if normalizedLink != "" && normalizeURL(story.URL) == normalizedLink {
+			return &stories[i]
+		}
+	}
+	return nil
+}
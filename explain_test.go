@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turnage/graw/reddit"
+)
+
+// fakeBot serves canned listings. Any other reddit.Bot call panics on the
+// nil embedded interface, which is what we want in tests that shouldn't
+// write to Reddit.
+type fakeBot struct {
+	reddit.Bot
+	posts []*reddit.Post
+}
+
+func (f *fakeBot) ListingWithParams(path string, params map[string]string) (reddit.Harvest, error) {
+	return reddit.Harvest{Posts: f.posts}, nil
+}
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><title>HN</title>
+<item>
+  <title>A fresh story</title>
+  <link>https://example.com/fresh</link>
+  <guid>https://news.ycombinator.com/item?id=100</guid>
+  <pubDate>Mon, 01 Jan 2024 00:00:00 +0000</pubDate>
+</item>
+<item>
+  <title>Show HN: Gizmo</title>
+  <link>https://gizmo.dev/</link>
+  <guid>https://news.ycombinator.com/item?id=101</guid>
+  <pubDate>Mon, 01 Jan 2024 00:00:00 +0000</pubDate>
+</item>
+</channel></rss>`
+
+func newTestApp(t *testing.T, posts []*reddit.Post) *App {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, testFeed)
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := defaultConfig()
+	cfg.Feed.Protocol = "http"
+	cfg.Feed.BaseURL = strings.TrimPrefix(srv.URL, "http://")
+
+	st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	return &App{cfg: cfg, source: &hnrssSource{cfg: cfg}, bot: &fakeBot{posts: posts}, store: st}
+}
+
+func TestExplain(t *testing.T) {
+	posts := []*reddit.Post{{
+		Name:       "t3_gizmo",
+		Permalink:  "/r/hackernews/comments/gizmo/gizmo_a_tiny_build_tool/",
+		Title:      "Gizmo – a tiny build tool",
+		URL:        "https://github.com/someone/gizmo",
+		CreatedUTC: uint64(time.Now().Add(-3 * time.Hour).Unix()),
+	}}
+	app := newTestApp(t, posts)
+
+	if err := app.store.RecordPost(Story{
+		ID:    99,
+		URL:   "https://example.com/old",
+		Title: "An old story",
+	}, "hackernews", "t3_old"); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		target string
+		title  string
+		want   []string
+	}{
+		{
+			name:   "Title match via HN ID lookup in feed",
+			target: "101",
+			want:   []string{"DUPLICATE", RULE_TITLE, "https://www.reddit.com/r/hackernews/comments/gizmo/", "Show HN: Gizmo"},
+		},
+		{
+			name:   "Stored post by URL",
+			target: "http://www.example.com/old/",
+			want:   []string{"DUPLICATE", RULE_HN_ID_STORE, "https://www.reddit.com/comments/old"},
+		},
+		{
+			name:   "Would be posted",
+			target: "https://news.ycombinator.com/item?id=100",
+			want:   []string{"NOT A DUPLICATE", "HN story 100", "closest title scores"},
+		},
+		{
+			name:   "Unknown URL not in feed",
+			target: "https://nowhere.example/article",
+			want:   []string{"NOT A DUPLICATE", "title check skipped", "isn't in the current feed"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := app.explain(context.Background(), &buf, tc.target, tc.title); err != nil {
+				t.Fatalf("explain: %v", err)
+			}
+			out := buf.String()
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output missing %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
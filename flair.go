@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// flairRule is a compiled FlairRule.
+type flairRule struct {
+	storyMatcher
+	subreddits []string
+	templateID string
+	text       string
+}
+
+// Flairer sets link flair on new posts from the first rule that matches.
+// A nil Flairer does nothing.
+type Flairer struct {
+	api   RedditAPI
+	rules []flairRule
+}
+
+// newFlairer returns nil when flair is disabled or has no rules.
+func newFlairer(cfg *Config, api RedditAPI) (*Flairer, error) {
+	if !cfg.Flair.Enabled || len(cfg.Flair.Rules) == 0 {
+		return nil, nil
+	}
+
+	f := &Flairer{api: api}
+	for i, r := range cfg.Flair.Rules {
+		m, err := newStoryMatcher(r.StoryMatch, cfg.Flair.Categories[r.Category]...)
+		if err != nil {
+			return nil, fmt.Errorf("flair.rules[%d].%w", i, err)
+		}
+		f.rules = append(f.rules, flairRule{
+			storyMatcher: m,
+			subreddits:   r.Subreddits,
+			templateID:   r.TemplateID,
+			text:         r.Text,
+		})
+	}
+	return f, nil
+}
+
+// ruleFor returns the first rule matching story in subreddit.
+func (f *Flairer) ruleFor(subreddit string, story Story) (flairRule, bool) {
+	if f == nil {
+		return flairRule{}, false
+	}
+	for _, r := range f.rules {
+		if len(r.subreddits) > 0 && !slices.ContainsFunc(r.subreddits, func(s string) bool { return strings.EqualFold(s, subreddit) }) {
+			continue
+		}
+		if r.matches(story) {
+			return r, true
+		}
+	}
+	return flairRule{}, false
+}
+
+// Describe is how the flair for story shows up in a plan, or "".
+func (f *Flairer) Describe(subreddit string, story Story) string {
+	r, ok := f.ruleFor(subreddit, story)
+	if !ok {
+		return ""
+	}
+	if r.text != "" {
+		return r.text
+	}
+	return "template " + r.templateID
+}
+
+// Apply flairs the post name. If the template can't be applied it falls
+// back to plain flair text; failures are only logged, as the post itself
+// has already gone up.
+func (f *Flairer) Apply(ctx context.Context, subreddit, name string, story Story) {
+	r, ok := f.ruleFor(subreddit, story)
+	if !ok {
+		return
+	}
+
+	if r.templateID != "" {
+		err := f.api.SelectFlair(ctx, subreddit, name, r.templateID, r.text)
+		if err == nil {
+			return
+		}
+		logger.Printf("Warning: failed to apply flair template %s to %s: %v\n", r.templateID, name, err)
+		if r.text == "" {
+			return
+		}
+	}
+
+	if err := f.api.SetFlairText(ctx, subreddit, name, r.text); err != nil {
+		logger.Printf("Warning: failed to set flair %q on %s: %v\n", r.text, name, err)
+	}
+}
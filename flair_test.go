@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlairRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hnbot.toml")
+	err := os.WriteFile(path, []byte(`
+[flair]
+enabled = true
+
+[flair.categories]
+video = ["youtube.com", "vimeo.com"]
+
+[[flair.rules]]
+types = ["show"]
+subreddits = ["hackernews"]
+template_id = "show-template"
+
+[[flair.rules]]
+category = "video"
+text = "Video"
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("REDDIT_SECRET", "secret")
+	t.Setenv("REDDIT_PASSWORD", "password")
+
+	cfg, _, err := loadConfig("run", []string{"-config", path})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	f, err := newFlairer(cfg, nil)
+	if err != nil {
+		t.Fatalf("newFlairer: %v", err)
+	}
+
+	testCases := []struct {
+		name      string
+		subreddit string
+		story     Story
+		want      string
+	}{
+		{"Show HN", "hackernews", Story{Type: STORY_TYPE_SHOW, URL: "https://example.com"}, "template show-template"},
+		{"Show HN elsewhere", "golang", Story{Type: STORY_TYPE_SHOW, URL: "https://example.com"}, ""},
+		{"Category domain", "golang", Story{Type: STORY_TYPE_STORY, URL: "https://m.youtube.com/watch?v=1"}, "Video"},
+		{"No match", "hackernews", Story{Type: STORY_TYPE_STORY, URL: "https://example.com"}, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := f.Describe(tc.subreddit, tc.story); got != tc.want {
+				t.Errorf("Describe = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFlairFallsBackToText(t *testing.T) {
+	api := &fakeRedditAPI{fail: map[string]error{
+		"SelectFlair": &RedditError{Code: "BAD_FLAIR_TEMPLATE_ID"},
+	}}
+
+	cfg := defaultConfig()
+	cfg.Flair.Enabled = true
+	cfg.Flair.Rules = []FlairRule{{StoryMatch: StoryMatch{TitlePrefix: "Show HN:"}, TemplateID: "gone", Text: "Show HN"}}
+
+	f, err := newFlairer(cfg, api)
+	if err != nil {
+		t.Fatalf("newFlairer: %v", err)
+	}
+
+	f.Apply(context.Background(), "hackernews", "t3_abc", Story{Title: "Show HN: A thing"})
+	f.Apply(context.Background(), "hackernews", "t3_def", Story{Title: "Something else"})
+
+	want := []string{
+		"SelectFlair hackernews t3_abc gone Show HN",
+		"SetFlairText hackernews t3_abc Show HN",
+	}
+	if fmt.Sprint(api.calls) != fmt.Sprint(want) {
+		t.Errorf("calls = %q, want %q", api.calls, want)
+	}
+
+	var nilFlairer *Flairer
+	nilFlairer.Apply(context.Background(), "hackernews", "t3_abc", Story{Title: "Show HN: A thing"})
+}
@@ -3,12 +3,15 @@ module hnbot
 go 1.24.1
 
 require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/PuerkitoBio/goquery v1.8.0
 	github.com/mmcdole/gofeed v1.3.0
 	github.com/turnage/graw v0.0.0-20250321203609-ee225b526649
+	golang.org/x/net v0.38.0
+	golang.org/x/text v0.23.0
 )
 
 require (
-	github.com/PuerkitoBio/goquery v1.8.0 // indirect
 	github.com/andybalholm/cascadia v1.3.1 // indirect
 	github.com/golang/protobuf v1.3.2 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
@@ -17,7 +20,5 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/turnage/redditproto v0.0.0-20151223012412-afedf1b6eddb // indirect
-	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/oauth2 v0.27.0 // indirect
-	golang.org/x/text v0.23.0 // indirect
 )
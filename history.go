@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PreviousDiscussion is an earlier HN submission of the same URL.
+type PreviousDiscussion struct {
+	HNID      int       `json:"hn_id"`
+	Title     string    `json:"title"`
+	Points    int       `json:"points"`
+	Comments  int       `json:"comments"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// History finds earlier HN discussions of a story's URL on Algolia so the
+// bot comment can link to them. Lookups are cached in the store, and any
+// failure just leaves the list out. A nil History does nothing.
+type History struct {
+	client      *http.Client
+	store       *Store
+	agent       string
+	baseURL     string
+	timeout     time.Duration
+	ttl         time.Duration
+	minComments int
+	maxResults  int
+}
+
+// newHistory returns nil when previous-discussion lookups are disabled.
+func newHistory(cfg *Config, client *http.Client, st *Store) *History {
+	if !cfg.History.Enabled {
+		return nil
+	}
+
+	return &History{
+		client:      client,
+		store:       st,
+		agent:       cfg.Reddit.Agent,
+		baseURL:     strings.TrimSuffix(cfg.Feed.AlgoliaURL, "/"),
+		timeout:     cfg.History.Timeout,
+		ttl:         cfg.History.CacheTTL,
+		minComments: cfg.History.MinComments,
+		maxResults:  cfg.History.MaxResults,
+	}
+}
+
+// Previous returns earlier discussions of story's URL, newest first.
+func (h *History) Previous(ctx context.Context, story Story) []PreviousDiscussion {
+	if h == nil || story.URL == "" || hnItemID(story.URL) != 0 {
+		return nil
+	}
+
+	key := normalizeURL(story.URL)
+
+	var found []PreviousDiscussion
+	if cached, ok := h.store.Discussions(key); ok && time.Since(cached.FetchedAt) < h.ttl {
+		found = cached.Discussions
+	} else {
+		var err error
+		found, err = h.lookup(ctx, story.URL, key)
+		if err != nil {
+			logger.Printf("Warning: previous discussions lookup failed for %s: %v\n", story.URL, err)
+			return nil
+		}
+		h.store.SetDiscussions(key, found)
+	}
+
+	var out []PreviousDiscussion
+	for _, d := range found {
+		if d.HNID == story.ID || d.Comments < h.minComments {
+			continue
+		}
+		out = append(out, d)
+		if len(out) == h.maxResults {
+			break
+		}
+	}
+	return out
+}
+
+func (h *History) lookup(ctx context.Context, rawURL, key string) ([]PreviousDiscussion, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	query := url.Values{}
+	query.Set("query", rawURL)
+	query.Set("restrictSearchableAttributes", "url")
+	query.Set("tags", "story")
+	query.Set("hitsPerPage", "50")
+
+	var resp algoliaResponse
+	if err := getJSON(ctx, h.client, h.agent, h.baseURL+"/search?"+query.Encode(), &resp); err != nil {
+		return nil, err
+	}
+
+	// Algolia matches URL words, not whole URLs, so keep only exact hits.
+	var found []PreviousDiscussion
+	for _, hit := range resp.Hits {
+		id, err := strconv.Atoi(hit.ObjectID)
+		if err != nil || normalizeURL(hit.URL) != key {
+			continue
+		}
+		found = append(found, PreviousDiscussion{
+			HNID:      id,
+			Title:     hit.Title,
+			Points:    hit.Points,
+			Comments:  hit.NumComments,
+			CreatedAt: time.Unix(hit.CreatedAtI, 0).UTC(),
+		})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].CreatedAt.After(found[j].CreatedAt)
+	})
+
+	return found, nil
+}
+
+// previousDiscussionsMarkdown renders the list appended to the bot comment.
+func previousDiscussionsMarkdown(prev []PreviousDiscussion) string {
+	if len(prev) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Previous discussions:\n\n")
+	for _, d := range prev {
+		fmt.Fprintf(&b, "- [%s](%s) (%d points, %d comments)\n", d.CreatedAt.Format("2006-01-02"), hnItemURL(d.HNID), d.Points, d.Comments)
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestHistory(t *testing.T, handler http.HandlerFunc) *History {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	cfg := defaultConfig()
+	cfg.Feed.AlgoliaURL = srv.URL
+	cfg.History.MaxResults = 2
+	return newHistory(cfg, srv.Client(), st)
+}
+
+func TestHistoryPrevious(t *testing.T) {
+	requests := 0
+	h := newTestHistory(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("restrictSearchableAttributes") != "url" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"hits":[
+			{"objectID":"1","title":"Old","url":"http://www.example.com/post","points":50,"num_comments":40,"created_at_i":1500000000},
+			{"objectID":"2","title":"Newer","url":"https://example.com/post/","points":90,"num_comments":70,"created_at_i":1600000000},
+			{"objectID":"3","title":"Quiet","url":"https://example.com/post","points":3,"num_comments":1,"created_at_i":1650000000},
+			{"objectID":"4","title":"Other page","url":"https://example.com/post/comments","points":500,"num_comments":300,"created_at_i":1660000000},
+			{"objectID":"5","title":"Current","url":"https://example.com/post","points":200,"num_comments":100,"created_at_i":1700000000}
+		]}`)
+	})
+
+	story := Story{ID: 5, Title: "Current", URL: "https://example.com/post"}
+
+	prev := h.Previous(context.Background(), story)
+	if len(prev) != 2 || prev[0].HNID != 2 || prev[1].HNID != 1 {
+		t.Fatalf("got %+v, want stories 2 then 1", prev)
+	}
+
+	h.Previous(context.Background(), story)
+	if requests != 1 {
+		t.Errorf("made %d requests, want the second lookup served from cache", requests)
+	}
+
+	md := previousDiscussionsMarkdown(prev)
+	want := "- [2020-09-13](https://news.ycombinator.com/item?id=2) (90 points, 70 comments)"
+	if !strings.Contains(md, want) {
+		t.Errorf("markdown missing %q:\n%s", want, md)
+	}
+}
+
+func TestHistoryUnavailable(t *testing.T) {
+	h := newTestHistory(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	})
+
+	if prev := h.Previous(context.Background(), Story{ID: 1, URL: "https://example.com/a"}); prev != nil {
+		t.Errorf("got %+v, want nothing when Algolia is down", prev)
+	}
+	if _, ok := h.store.Discussions(normalizeURL("https://example.com/a")); ok {
+		t.Error("failed lookups must not be cached")
+	}
+
+	var nilHistory *History
+	if prev := nilHistory.Previous(context.Background(), Story{URL: "https://example.com/a"}); prev != nil {
+		t.Error("nil History should return nothing")
+	}
+}
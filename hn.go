@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// hnItemID extracts N from a news.ycombinator.com/item?id=N link, as found
+// in hnrss GUIDs. It returns 0 for anything else.
+func hnItemID(rawURL string) int {
+	if !strings.Contains(rawURL, HN_BASE_URL) {
+		return 0
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0
+	}
+
+	if strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") != HN_BASE_URL || u.Path != "/item" {
+		return 0
+	}
+
+	id, err := strconv.Atoi(u.Query().Get("id"))
+	if err != nil || id <= 0 {
+		return 0
+	}
+
+	return id
+}
+
+func hnItemURL(id int) string {
+	return "https://" + HN_BASE_URL + "/item?id=" + strconv.Itoa(id)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHNItemID(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected int
+	}{
+		{"https://news.ycombinator.com/item?id=40000000", 40000000},
+		{"http://news.ycombinator.com/item?id=123", 123},
+		{"https://news.ycombinator.com/item?id=123&p=2", 123},
+		{"https://news.ycombinator.com/user?id=pg", 0},
+		{"https://news.ycombinator.com/item?id=abc", 0},
+		{"https://example.com/item?id=123", 0},
+		{"https://example.com/?ref=news.ycombinator.com/item?id=1", 0},
+		{"", 0},
+	}
+
+	for _, tc := range testCases {
+		if got := hnItemID(tc.input); got != tc.expected {
+			t.Errorf("hnItemID(%q) = %d, want %d", tc.input, got, tc.expected)
+		}
+	}
+}
+
+func TestIsDuplicateByHNID(t *testing.T) {
+	st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	original := Story{
+		ID:    42,
+		URL:   "https://example.com/first-link",
+		Title: "Original title",
+	}
+	if err := st.RecordPost(original, "hackernews", "t3_first"); err != nil {
+		t.Fatalf("RecordPost: %v", err)
+	}
+
+	// HN mods re-linked and renamed the story: nothing matches but the ID.
+	if !isDuplicate(st, "hackernews", 42, normalizeURL("https://other.org/better-source"), "Completely different", nil, time.Now(), DEFAULT_TITLE_THRESHOLD) {
+		t.Error("story with same HN ID should be a duplicate via the store")
+	}
+
+	listings := []RedditPost{{
+		HNID:      7,
+		URL:       "https://news.ycombinator.com/item?id=7",
+		Title:     "Ask HN: Something",
+		CreatedAt: time.Now().Add(-time.Hour),
+	}}
+	if !isDuplicate(st, "hackernews", 7, normalizeURL("https://news.ycombinator.com/item?id=7"), "Ask HN: Renamed", listings, time.Now().Add(-48*time.Hour), DEFAULT_TITLE_THRESHOLD) {
+		t.Error("story with same HN ID should be a duplicate via listings")
+	}
+
+	if isDuplicate(st, "hackernews", 43, normalizeURL("https://other.org/unrelated"), "Unrelated story about gardening", listings, time.Now().Add(-48*time.Hour), DEFAULT_TITLE_THRESHOLD) {
+		t.Error("different HN ID with different URL and title should not be a duplicate")
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -15,27 +17,40 @@ import (
 	"github.com/turnage/graw/reddit"
 )
 
-const (
-	REDDIT_TIMEOUT        = 30
-	RSS_TIMEOUT           = 120
-	REDDIT_SUBREDDIT      = "hackernews"
-	REDDIT_AGENT          = "hackernews:hnmod:0.1.0"
-	REDDIT_USERNAME       = "hnmod"
-	REDDIT_ID             = "v7eIyAVMwtcKG00ahocIXg"
-	HN_BASE_URL           = "news.ycombinator.com"
-	RSS_PROTOCOL          = "https"
-	RSS_BASE_URL          = "hnrss.org"
-	RSS_FEED              = "frontpage"
-	RSS_COUNT             = 50
-	HN_POINTS_THRESHOLD   = 100
-	HN_COMMENTS_THRESHOLD = 10
-	DUPLICATE_CHECK_HOURS = 48
-)
+const HN_BASE_URL = "news.ycombinator.com"
+
+// logger is where progress and warnings go: stdout, except for commands
+// whose own output is on stdout and may be piped.
+var logger = log.New(os.Stdout, "", 0)
+
+// App is everything a run needs: the loaded configuration, the story
+// source, the logged in bot, the local store and the optional link
+// enrichment steps.
+type App struct {
+	cfg       *Config
+	source    Source
+	bot       reddit.Bot
+	store     *Store
+	resolver  *Resolver
+	canonical *CanonicalFetcher
+	history   *History
+	router    *Router
+	client    *http.Client
+	templates *Templates
+	api       RedditAPI
+	flair     *Flairer
+	limiter   *RateLimiter
+	plan      *Plan
+}
 
 type RedditPost struct {
-	URL       string
-	Title     string
-	CreatedAt time.Time
+	Name          string
+	Permalink     string
+	HNID          int
+	URL           string
+	NormalizedURL string
+	Title         string
+	CreatedAt     time.Time
 }
 
 func normalizeURL(rawURL string) string {
@@ -43,10 +58,6 @@ func normalizeURL(rawURL string) string {
 		return rawURL
 	}
 
-	if strings.Contains(rawURL, "reddit.com") || strings.Contains(rawURL, "redd.it") {
-		return normalizeRedditURL(rawURL)
-	}
-
 	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
 		return rawURL
@@ -63,83 +74,197 @@ func normalizeURL(rawURL string) string {
 		parsedURL.Host = strings.TrimPrefix(parsedURL.Host, "www.")
 	}
 
+	if canonical, ok := canonicalizerFor(parsedURL.Host); ok {
+		if key, ok := canonical(parsedURL); ok {
+			return key
+		}
+	}
+
 	parsedURL.Path = strings.TrimSuffix(parsedURL.Path, "/")
 	if parsedURL.Path == "" {
 		parsedURL.Path = "/"
 	}
 
 	parsedURL.Fragment = ""
-	parsedURL.RawQuery = ""
+	parsedURL.RawQuery = cleanQuery(parsedURL.Host, parsedURL.RawQuery)
 	parsedURL.RawPath = ""
 
 	return parsedURL.String()
 }
 
 func main() {
-	fmt.Println("Starting")
+	cmd, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	setLogOutput(cmd == "plan")
+
+	cfg, rest, err := loadConfig(cmd, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	setLogOutput(cfg.DryRun || cmd == "plan")
+
+	switch cmd {
+	case "plan":
+		cfg.DryRun = true
+		err = runSingle(cfg)
+	case "run":
+		err = runSingle(cfg)
+	case "daemon":
+		err = runDaemon(cfg)
+	case "explain":
+		err = runExplain(cfg, rest)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q (expected run, plan, daemon or explain)\n", cmd)
+		os.Exit(2)
+	}
 
-	bot, err := newBot()
 	if err != nil {
 		panic(err)
 	}
+}
 
-	if bot == nil {
-		panic("Error: Reddit bot is nil")
+// setLogOutput sends logs to stderr for dry runs, so that stdout has only
+// the plan and "hnbot plan -json | jq" works.
+func setLogOutput(dryRun bool) {
+	if dryRun {
+		logger.SetOutput(os.Stderr)
+		return
+	}
+	logger.SetOutput(os.Stdout)
+}
+
+func newApp(cfg *Config) (*App, error) {
+	client := newHTTPClient(cfg)
+
+	source, err := newSource(cfg, client)
+	if err != nil {
+		return nil, err
 	}
 
-	var feed *gofeed.Feed
-	maxRetries := 5
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		feed, err = getFeed()
-		if err == nil && feed != nil {
-			break
-		}
-		if attempt == maxRetries-1 {
-			panic(fmt.Sprintf("failed to get feed after %d attempts: %v", maxRetries, err))
-		}
-		backoff := time.Duration(1<<uint(attempt)) * time.Second // 1s, 2s, 4s, 8s, 16s
-		fmt.Printf("Feed fetch failed (attempt %d/%d): %v. Retrying in %v...\n", attempt+1, maxRetries, err, backoff)
-		time.Sleep(backoff)
+	router, err := newRouter(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	err = processFeed(bot, feed)
+	templates, err := newTemplates(cfg)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	// graw and RedditClient spend the same rate limit budget, so they
+	// share one limiter.
+	limiter := newRateLimiter()
+	api := newRedditClient(cfg, limiter.Client(client))
+
+	flair, err := newFlairer(cfg, api)
+	if err != nil {
+		return nil, err
+	}
+
+	bot, err := newBot(cfg, client, limiter)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Println("Done")
+	if bot == nil {
+		return nil, errors.New("Reddit bot is nil")
+	}
+
+	st, err := openStore(cfg.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	st.readOnly = cfg.DryRun
+
+	return &App{
+		cfg:       cfg,
+		source:    source,
+		bot:       bot,
+		store:     st,
+		resolver:  newResolver(cfg, client, st),
+		canonical: newCanonicalFetcher(cfg, client, st),
+		history:   newHistory(cfg, client, st),
+		router:    router,
+		client:    client,
+		templates: templates,
+		api:       api,
+		flair:     flair,
+		limiter:   limiter,
+	}, nil
 }
 
-func buildFeedUrl() *url.URL {
+func runSingle(cfg *Config) error {
+	logger.Println("Starting")
+
+	app, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := app.runOnce(context.Background()); err != nil {
+		return err
+	}
+
+	logger.Println("Done")
+	return nil
+}
+
+// sleepContext sleeps for d or until ctx is done, reporting whether the
+// full duration elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func buildFeedUrl(cfg *Config, feed HnrssFeed) *url.URL {
 	rssURL := &url.URL{
-		Scheme: RSS_PROTOCOL,
-		Host:   RSS_BASE_URL,
-		Path:   RSS_FEED,
+		Scheme: cfg.Feed.Protocol,
+		Host:   cfg.Feed.BaseURL,
+		Path:   feed.Name,
 	}
 
+	points, comments := feed.thresholds(cfg)
+
 	query := rssURL.Query()
-	query.Set("count", fmt.Sprintf("%d", RSS_COUNT))
-	query.Set("points", fmt.Sprintf("%d", HN_POINTS_THRESHOLD))
-	query.Set("comments", fmt.Sprintf("%d", HN_COMMENTS_THRESHOLD))
+	query.Set("count", fmt.Sprintf("%d", cfg.Feed.Count))
+	query.Set("points", fmt.Sprintf("%d", points))
+	query.Set("comments", fmt.Sprintf("%d", comments))
+	if feed.Query != "" {
+		query.Set("q", feed.Query)
+	}
 
 	rssURL.RawQuery = query.Encode()
 
 	return rssURL
 }
 
-func getFeed() (*gofeed.Feed, error) {
-	fmt.Println("Getting feed")
+func getFeed(ctx context.Context, cfg *Config, feedCfg HnrssFeed) (*gofeed.Feed, error) {
+	logger.Println("Getting feed", feedCfg.Name)
 
-	rssURL := buildFeedUrl()
+	rssURL := buildFeedUrl(cfg, feedCfg)
 
-	fmt.Println("RSS URL:", rssURL.String())
+	logger.Println("RSS URL:", rssURL.String())
 
 	fp := gofeed.NewParser()
 	if fp == nil {
 		return nil, errors.New("failed to create feed parser")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*RSS_TIMEOUT)
+	ctx, cancel := context.WithTimeout(ctx, cfg.Feed.Timeout)
 	defer cancel()
 
 	feed, err := fp.ParseURLWithContext(rssURL.String(), ctx)
@@ -171,64 +296,134 @@ func getFeed() (*gofeed.Feed, error) {
 	return feed, nil
 }
 
-func processFeed(bot reddit.Bot, feed *gofeed.Feed) error {
-	if bot == nil {
+// processFeed posts new stories. Cancelling ctx stops the run before the
+// next story or subreddit; a post that has already started is finished
+// with its flair and comment, since postNew runs without ctx's
+// cancellation.
+func (a *App) processFeed(ctx context.Context, stories []Story) error {
+	if a.bot == nil {
 		return errors.New("bot is nil")
 	}
 
-	if feed == nil {
-		return errors.New("feed is nil")
+	if a.store == nil {
+		return errors.New("store is nil")
 	}
 
-	fmt.Println("Processing feed")
-	processedCount := 0
+	logger.Println("Processing feed")
+	postedCount := 0
 	errorCount := 0
 
-	existingPosts, err := getExistingPosts(bot)
-	if err != nil {
-		return fmt.Errorf("error getting existing posts: %w", err)
-	}
+	// Listings are fetched the first time a subreddit is targeted.
+	listings := make(map[string][]RedditPost)
+	// Subreddits that refused the bot are skipped for the rest of the run.
+	refused := make(map[string]bool)
 
-	cutoffTime := time.Now().Add(-DUPLICATE_CHECK_HOURS * time.Hour)
+	cutoffTime := time.Now().Add(-time.Duration(a.cfg.Dedupe.CheckHours) * time.Hour)
 
-	for i, item := range feed.Items {
-		if item == nil {
-			fmt.Printf("Warning: skipping nil item at index %d\n", i)
-			continue
+feed:
+	for i, story := range mergeStories(stories) {
+		if ctx.Err() != nil {
+			logger.Println("Stopping early: shutdown requested")
+			break
 		}
 
-		if item.PublishedParsed == nil {
-			fmt.Printf("Warning: skipping item with nil publish date: %s\n", item.Title)
+		story.Title = cleanTitle(story.Title)
+
+		if story.Time.IsZero() {
+			logger.Printf("Warning: skipping story with no publish date: %s\n", story.Title)
+			a.plan.skip("", story, "", "no publish date")
 			continue
 		}
 
-		if item.Link == "" {
-			fmt.Printf("Warning: skipping item with empty link: %s\n", item.Title)
+		if story.URL == "" {
+			logger.Printf("Warning: skipping story with empty link: %s\n", story.Title)
+			a.plan.skip("", story, "", "empty link")
 			continue
 		}
 
-		normalizedLink := normalizeURL(item.Link)
+		normalizedLink := a.normalize(ctx, story.URL)
 
-		if isDuplicate(normalizedLink, item.Title, existingPosts, cutoffTime) {
-			fmt.Printf("Post already exists, skipping: %s\n", item.Link)
-			continue
-		}
+		a.store.Seen(story)
 
-		err := postNew(bot, item, &existingPosts, cutoffTime)
-		if err != nil {
-			errorCount++
-			fmt.Printf("Error posting item %d (%s): %v\n", i, item.Title, err)
-			if errorCount >= 3 {
-				return fmt.Errorf("too many posting errors (%d): aborting", errorCount)
+		for _, subreddit := range a.targetsFor(story) {
+			if ctx.Err() != nil {
+				logger.Println("Stopping early: shutdown requested")
+				break feed
+			}
+
+			if refused[strings.ToLower(subreddit)] {
+				continue
+			}
+
+			if domain := linkDomain(story.URL); !story.IsText() && a.store.DomainBanned(subreddit, domain) {
+				logger.Printf("%s is banned in r/%s, skipping: %s\n", domain, subreddit, story.URL)
+				a.plan.skip(subreddit, story, normalizedLink, domain+" is banned in r/"+subreddit)
+				continue
+			}
+
+			existingPosts, ok := listings[strings.ToLower(subreddit)]
+			if !ok {
+				var err error
+				existingPosts, err = a.getExistingPosts(ctx, subreddit)
+				if err != nil {
+					return fmt.Errorf("error getting existing posts from r/%s: %w", subreddit, err)
+				}
+				listings[strings.ToLower(subreddit)] = existingPosts
+			}
+
+			if dup := findDuplicate(a.store, subreddit, story.ID, normalizedLink, story.Title, existingPosts, cutoffTime, a.cfg.Dedupe.TitleThreshold); dup != nil {
+				logger.Println("Duplicate:", dup)
+				logger.Printf("Post already exists in r/%s, skipping: %s\n", subreddit, story.URL)
+				a.plan.skip(subreddit, story, normalizedLink, dup.String())
+				continue
+			}
+
+			posted, err := a.postNew(context.WithoutCancel(ctx), subreddit, story, normalizedLink, &existingPosts, cutoffTime)
+			listings[strings.ToLower(subreddit)] = existingPosts
+			if posted {
+				postedCount++
+			}
+			if err != nil {
+				logger.Printf("Error posting item %d (%s) to r/%s: %v\n", i, story.Title, subreddit, err)
+
+				// Errors about the story itself (a title Reddit won't
+				// take, say) don't count towards aborting, a subreddit
+				// that won't have the bot is dropped, and errors about
+				// the bot's login end the run.
+				var rerr *RedditError
+				if errors.As(err, &rerr) {
+					switch {
+					case rerr.Fatal():
+						return fmt.Errorf("aborting: %w", err)
+					case rerr.StatusCode == http.StatusForbidden:
+						logger.Printf("r/%s refused the bot, not posting there again this run\n", subreddit)
+						refused[strings.ToLower(subreddit)] = true
+						continue
+					case rerr.RateLimited():
+						logger.Println("Still rate limited by Reddit, stopping this run")
+						break feed
+					case rerr.Code != "":
+						continue
+					}
+				}
+
+				errorCount++
+				if errorCount >= 3 {
+					return fmt.Errorf("too many posting errors (%d): aborting", errorCount)
+				}
+				continue
 			}
-			continue
 		}
-		processedCount++
+	}
 
-		time.Sleep(2 * time.Second)
+	if err := a.store.Save(); err != nil {
+		return fmt.Errorf("error saving store: %w", err)
 	}
 
-	fmt.Printf("Successfully processed %d items\n", processedCount)
+	logger.Printf("Successfully posted %d items\n", postedCount)
+	if a.plan == nil {
+		logger.Printf("Reddit rate limit: %s\n", a.limiter.Budget())
+	}
 	return nil
 }
 
@@ -257,19 +452,21 @@ func normalizeRedditURL(rawURL string) string {
 	return cleanURL
 }
 
-func getExistingPosts(bot reddit.Bot) ([]RedditPost, error) {
-	if bot == nil {
+func (a *App) getExistingPosts(ctx context.Context, subreddit string) ([]RedditPost, error) {
+	if a.bot == nil {
 		return nil, errors.New("bot is nil")
 	}
 
-	fmt.Println("Getting existing posts from subreddit")
+	logger.Println("Getting existing posts from r/" + subreddit)
 	var allPosts []RedditPost
+	var recent []int // posts inside the dedupe window
+	cutoffTime := time.Now().Add(-time.Duration(a.cfg.Dedupe.CheckHours) * time.Hour)
 	var lastErr error
 	successCount := 0
 
 	pageTypes := []string{"new", "hot", "top"}
 	for _, pageType := range pageTypes {
-		postUrl := fmt.Sprintf("/r/%s/%s", REDDIT_SUBREDDIT, pageType)
+		postUrl := fmt.Sprintf("/r/%s/%s", subreddit, pageType)
 		postOpts := map[string]string{
 			"limit": "100",
 		}
@@ -278,9 +475,9 @@ func getExistingPosts(bot reddit.Bot) ([]RedditPost, error) {
 			postOpts["t"] = "week"
 		}
 
-		posts, err := bot.ListingWithParams(postUrl, postOpts)
+		posts, err := a.bot.ListingWithParams(postUrl, postOpts)
 		if err != nil {
-			fmt.Printf("Warning: failed to get %s listings: %v\n", pageType, err)
+			logger.Printf("Warning: failed to get %s listings: %v\n", pageType, err)
 			lastErr = err
 			continue
 		}
@@ -293,169 +490,340 @@ func getExistingPosts(bot reddit.Bot) ([]RedditPost, error) {
 
 		for _, post := range posts.Posts {
 			if post.URL != "" && !post.Deleted {
+				hnID := hnItemID(post.URL)
+				if hnID == 0 && post.IsSelf {
+					hnID = selfPostHNID(post.SelfText)
+				}
+				createdAt := time.Unix(int64(post.CreatedUTC), 0)
+				if !createdAt.Before(cutoffTime) {
+					recent = append(recent, len(allPosts))
+				}
 				allPosts = append(allPosts, RedditPost{
-					URL:       post.URL,
-					Title:     post.Title,
-					CreatedAt: time.Unix(int64(post.CreatedUTC), 0),
+					Name:          post.Name,
+					Permalink:     "https://www.reddit.com" + post.Permalink,
+					HNID:          hnID,
+					URL:           post.URL,
+					NormalizedURL: normalizeURL(post.URL),
+					Title:         post.Title,
+					CreatedAt:     createdAt,
 				})
 			}
 		}
 	}
 
+	// Only posts inside the dedupe window are compared, so only they are
+	// worth resolving and fetching canonical URLs for.
+	links := make([]string, len(recent))
+	for i, p := range recent {
+		links[i] = allPosts[p].URL
+	}
+	for i, normalized := range a.normalizeAll(ctx, links) {
+		allPosts[recent[i]].NormalizedURL = normalized
+	}
+
 	if successCount == 0 {
 		return nil, fmt.Errorf("failed to fetch any listings: %w", lastErr)
 	}
 
 	if len(allPosts) == 0 {
-		fmt.Println("No existing posts found")
+		logger.Println("No existing posts found")
 	} else {
-		fmt.Printf("Found %d existing posts across new/hot/top\n", len(allPosts))
+		logger.Printf("Found %d existing posts across new/hot/top\n", len(allPosts))
 	}
 
 	return allPosts, nil
 }
 
-func isDuplicate(normalizedURL string, title string, existingPosts []RedditPost, cutoffTime time.Time) bool {
-	titleLower := strings.ToLower(title)
-
-	for _, post := range existingPosts {
-		if post.CreatedAt.Before(cutoffTime) {
-			continue
-		}
+// Duplicate explains why a story counts as already posted: the rule that
+// matched and the listing post or stored record it matched against.
+type Duplicate struct {
+	Rule       string
+	Detail     string
+	Post       *RedditPost
+	Stored     *StoredItem
+	StoredPost StoredPost
+}
 
-		normalizedExisting := normalizeURL(post.URL)
-		if normalizedExisting == normalizedURL {
-			return true
-		}
+const (
+	RULE_HN_ID_STORE   = "same HN story ID (local store)"
+	RULE_HN_ID_LISTING = "same HN story ID (subreddit listing)"
+	RULE_URL_STORE     = "same normalized URL (local store)"
+	RULE_URL_LISTING   = "same normalized URL (subreddit listing)"
+	RULE_TITLE         = "similar title (subreddit listing)"
+)
 
-		if isSimilarTitle(titleLower, strings.ToLower(post.Title)) {
-			fmt.Printf("Similar title found: '%s' vs '%s'\n", title, post.Title)
-			return true
-		}
+func (d *Duplicate) String() string {
+	switch {
+	case d.Post != nil:
+		return fmt.Sprintf("%s: %s (%q, %s, posted %s ago)", d.Rule, d.Detail, d.Post.Title, d.Post.Permalink, time.Since(d.Post.CreatedAt).Round(time.Minute))
+	case d.Stored != nil:
+		return fmt.Sprintf("%s: %s (%q, %s, posted %s ago)", d.Rule, d.Detail, d.Stored.Title, redditPermalink(d.StoredPost.Name), time.Since(d.StoredPost.PostedAt).Round(time.Minute))
 	}
+	return d.Rule + ": " + d.Detail
+}
 
-	return false
+// redditPermalink builds a link to a post from its t3_ fullname. Posts
+// Reddit refused as already submitted have no name.
+func redditPermalink(name string) string {
+	if name == "" {
+		return "unknown (Reddit said it was already submitted)"
+	}
+	return "https://www.reddit.com/comments/" + strings.TrimPrefix(name, "t3_")
 }
 
-func isSimilarTitle(title1, title2 string) bool {
-	if title1 == title2 {
-		return true
+// findDuplicate checks, in order: the HN story ID against the store and
+// listings, then the normalized URL against the store, then URL and title
+// against recent listings. Store matches only count for posts made to
+// subreddit, and existingPosts should be that subreddit's listings. It
+// returns nil if nothing matched.
+func findDuplicate(st *Store, subreddit string, hnID int, normalizedURL string, title string, existingPosts []RedditPost, cutoffTime time.Time, titleThreshold float64) *Duplicate {
+	if posted, post, ok := st.FindPostedHN(hnID, subreddit); ok {
+		return &Duplicate{Rule: RULE_HN_ID_STORE, Detail: fmt.Sprintf("HN story %d posted as %s", hnID, post.Name), Stored: posted, StoredPost: post}
 	}
 
-	if strings.Contains(title1, title2) || strings.Contains(title2, title1) {
-		return true
+	if hnID != 0 {
+		for i, post := range existingPosts {
+			if post.HNID == hnID {
+				return &Duplicate{Rule: RULE_HN_ID_LISTING, Detail: fmt.Sprintf("HN story %d", hnID), Post: &existingPosts[i]}
+			}
+		}
 	}
 
-	words1 := strings.Fields(title1)
-	words2 := strings.Fields(title2)
+	if posted, post, ok := st.FindPosted(normalizedURL, subreddit); ok {
+		return &Duplicate{Rule: RULE_URL_STORE, Detail: normalizedURL, Stored: posted, StoredPost: post}
+	}
 
-	if len(words1) >= 4 && len(words2) >= 4 {
-		commonWords := 0
-		wordSet := make(map[string]bool)
-		for _, w := range words1 {
-			if len(w) > 2 {
-				wordSet[w] = true
-			}
+	for i, post := range existingPosts {
+		if post.CreatedAt.Before(cutoffTime) {
+			continue
 		}
-		for _, w := range words2 {
-			if len(w) > 2 && wordSet[w] {
-				commonWords++
-			}
+
+		normalizedExisting := post.NormalizedURL
+		if normalizedExisting == "" {
+			normalizedExisting = normalizeURL(post.URL)
 		}
-		minWords := min(len(words1), len(words2))
-		if minWords > 0 && float64(commonWords)/float64(minWords) > 0.7 {
-			return true
+		if normalizedExisting == normalizedURL {
+			return &Duplicate{Rule: RULE_URL_LISTING, Detail: normalizedURL, Post: &existingPosts[i]}
+		}
+
+		if sim, ok := isSimilarTitle(title, post.Title, titleThreshold); ok {
+			return &Duplicate{Rule: RULE_TITLE, Detail: fmt.Sprintf("score %.2f, %s", sim.Score, sim.Reason), Post: &existingPosts[i]}
 		}
 	}
 
-	return false
+	return nil
 }
 
-func postNew(bot reddit.Bot, item *gofeed.Item, existingPosts *[]RedditPost, cutoffTime time.Time) error {
-	if bot == nil {
-		return errors.New("bot is nil")
+func isDuplicate(st *Store, subreddit string, hnID int, normalizedURL string, title string, existingPosts []RedditPost, cutoffTime time.Time, titleThreshold float64) bool {
+	dup := findDuplicate(st, subreddit, hnID, normalizedURL, title, existingPosts, cutoffTime, titleThreshold)
+	if dup == nil {
+		return false
+	}
+	logger.Println("Duplicate:", dup)
+	return true
+}
+
+// postNew submits story to subreddit, or adds it to the plan in a dry
+// run, and reports whether it went up. Submissions Reddit refused but that
+// were handled, like ALREADY_SUB, return false with no error.
+func (a *App) postNew(ctx context.Context, subreddit string, story Story, normalizedLink string, existingPosts *[]RedditPost, cutoffTime time.Time) (bool, error) {
+	if a.bot == nil {
+		return false, errors.New("bot is nil")
 	}
 
-	if item == nil {
-		return errors.New("item is nil")
+	if story.Title == "" {
+		return false, errors.New("story title is empty")
 	}
 
-	if item.Title == "" {
-		return errors.New("item title is empty")
+	if story.URL == "" {
+		return false, errors.New("story link is empty")
 	}
 
-	if item.Link == "" {
-		return errors.New("item link is empty")
+	logger.Println("Posting:", story.Title)
+
+	isHn := story.IsText()
+	logger.Println("HN link:", isHn)
+
+	if isDuplicate(a.store, subreddit, story.ID, normalizedLink, story.Title, *existingPosts, cutoffTime, a.cfg.Dedupe.TitleThreshold) {
+		logger.Println("Post already exists (double-check), skipping:", story.URL)
+		return false, nil
 	}
 
-	fmt.Println("Posting:", item.Title)
+	title := a.submissionTitle(story)
+	if title == "" {
+		return false, errors.New("story title is empty")
+	}
 
-	isHn := strings.Contains(item.Link, HN_BASE_URL)
-	fmt.Println("HN link:", isHn)
+	commentTxt := ""
+	if !isHn {
+		commentTxt = a.commentText(ctx, story)
+	}
 
-	normalizedLink := normalizeURL(item.Link)
+	// Text posts go up as self posts carrying the story text, so they need
+	// no separate discussion comment.
+	body := ""
+	if isHn {
+		body = selfPostBody(story)
+	}
 
-	if isDuplicate(normalizedLink, item.Title, *existingPosts, cutoffTime) {
-		fmt.Println("Post already exists (double-check), skipping:", item.Link)
-		return nil
+	if a.plan != nil {
+		a.plan.post(subreddit, story, title, normalizedLink, body, a.flair.Describe(subreddit, story), commentTxt)
+		*existingPosts = append(*existingPosts, RedditPost{
+			HNID:          story.ID,
+			URL:           story.URL,
+			NormalizedURL: normalizedLink,
+			Title:         title,
+			CreatedAt:     time.Now(),
+		})
+		return true, nil
 	}
 
-	submission, err := bot.GetPostLink(REDDIT_SUBREDDIT, item.Title, item.Link)
+	submission, err := a.submit(ctx, subreddit, title, story, body)
 	if err != nil {
-		return fmt.Errorf("failed to create Reddit post: %w", err)
+		return false, a.submitFailed(subreddit, story, err)
 	}
 
 	if submission.Name == "" {
-		return errors.New("no post id returned")
+		return false, errors.New("no post id returned")
 	}
 
 	*existingPosts = append(*existingPosts, RedditPost{
-		URL:       item.Link,
-		Title:     item.Title,
-		CreatedAt: time.Now(),
+		Name:          submission.Name,
+		Permalink:     submission.URL,
+		HNID:          story.ID,
+		URL:           story.URL,
+		NormalizedURL: normalizedLink,
+		Title:         title,
+		CreatedAt:     time.Now(),
 	})
 
-	if isHn {
-		return nil
+	if err := a.store.RecordPost(story, subreddit, submission.Name); err != nil {
+		logger.Printf("Warning: failed to record post %s in store: %v\n", submission.Name, err)
 	}
 
-	hnLink := item.GUID
-	if hnLink == "" {
-		fmt.Printf("Warning: no HN link found in GUID for '%s', skipping comment\n", item.Title)
-		return nil
-	}
+	a.flair.Apply(ctx, subreddit, submission.Name, story)
 
-	if !strings.Contains(hnLink, HN_BASE_URL) {
-		fmt.Printf("Warning: GUID is not an HN link for '%s': %s, skipping comment\n", item.Title, hnLink)
-		return nil
+	if commentTxt == "" {
+		return true, nil
 	}
 
-	commentTxt := "Discussion on HN: " + hnLink
-	reply, err := bot.GetReply(submission.Name, commentTxt)
+	reply, err := a.bot.GetReply(submission.Name, commentTxt)
 	if err != nil {
-		return fmt.Errorf("failed to post comment: %w", err)
+		return true, fmt.Errorf("failed to post comment: %w", err)
 	}
 
 	if reply.Name == "" {
-		return errors.New("no comment id returned")
+		return true, errors.New("no comment id returned")
 	}
 
-	return nil
+	a.stickyComment(ctx, submission.Name, reply.Name, commentTxt)
+
+	return true, nil
 }
 
-func newBot() (reddit.Bot, error) {
-	fmt.Println("Getting Reddit bot")
+// submit posts story to subreddit as a self post with body or a link
+// post. If Reddit rejects the bot's token it logs in again, and if Reddit
+// rate limits it for at most MAX_RATELIMIT_WAIT it waits, then tries once
+// more. Reddit errors are returned as *RedditError.
+func (a *App) submit(ctx context.Context, subreddit, title string, story Story, body string) (reddit.Submission, error) {
+	for attempt := 0; ; attempt++ {
+		var submission reddit.Submission
+		var err error
+		if story.IsText() {
+			submission, err = a.bot.GetPostSelf(subreddit, title, body)
+		} else {
+			submission, err = a.bot.GetPostLink(subreddit, title, story.URL)
+		}
+		if err == nil {
+			return submission, nil
+		}
+
+		rerr := classifyRedditError("submit", err)
+		if rerr == nil {
+			return submission, err
+		}
+		if attempt > 0 {
+			return submission, rerr
+		}
 
-	secret := os.Getenv("REDDIT_SECRET")
-	if secret == "" {
-		return nil, errors.New("no Reddit secret provided in environment variable REDDIT_SECRET")
+		switch {
+		case rerr.StatusCode == http.StatusUnauthorized:
+			logger.Println("Reddit rejected the bot's token, logging in again")
+			if err := a.relogin(); err != nil {
+				return submission, fmt.Errorf("failed to log in again: %w", err)
+			}
+		case rerr.RateLimited():
+			wait := rerr.RetryAfter
+			if wait == 0 {
+				wait = time.Minute
+			}
+			if wait > MAX_RATELIMIT_WAIT {
+				return submission, rerr
+			}
+			logger.Printf("Rate limited by Reddit, waiting %v\n", wait)
+			if !sleepContext(ctx, wait) {
+				return submission, ctx.Err()
+			}
+		default:
+			return submission, rerr
+		}
 	}
+}
 
-	password := os.Getenv("REDDIT_PASSWORD")
-	if password == "" {
-		return nil, errors.New("no Reddit password provided in environment variable REDDIT_PASSWORD")
+// submitFailed handles the Reddit errors that say something about the
+// story rather than the bot: a link already submitted is recorded as a
+// duplicate, and a banned domain is quarantined in that subreddit. Other
+// errors are returned.
+func (a *App) submitFailed(subreddit string, story Story, err error) error {
+	var rerr *RedditError
+	if errors.As(err, &rerr) {
+		switch rerr.Code {
+		case REDDIT_ALREADY_SUB:
+			logger.Printf("Reddit says %s was already submitted to r/%s, recording it as a duplicate\n", story.URL, subreddit)
+			if err := a.store.RecordAlreadySubmitted(story, subreddit); err != nil {
+				logger.Printf("Warning: failed to record %s in store: %v\n", story.URL, err)
+			}
+			return nil
+		case REDDIT_DOMAIN_BANNED:
+			domain := linkDomain(story.URL)
+			logger.Printf("%s is banned in r/%s, skipping its links there for %v\n", domain, subreddit, DOMAIN_QUARANTINE)
+			if err := a.store.BanDomain(subreddit, domain); err != nil {
+				logger.Printf("Warning: failed to record banned domain %s in store: %v\n", domain, err)
+			}
+			return nil
+		}
 	}
+	return fmt.Errorf("failed to create Reddit post: %w", err)
+}
 
+// relogin replaces the bot with a freshly logged in one.
+func (a *App) relogin() error {
+	bot, err := newBot(a.cfg, a.client, a.limiter)
+	if err != nil {
+		return err
+	}
+	a.bot = bot
+	return nil
+}
+
+// targetsFor is where story should be posted: the subreddits of every
+// matching route, or else those of the feeds it came from, or
+// reddit.subreddit.
+func (a *App) targetsFor(story Story) []string {
+	var fallback []string
+	for _, sub := range story.Subreddits {
+		if sub == "" {
+			sub = a.cfg.Reddit.Subreddit
+		}
+		fallback = appendSubreddit(fallback, sub)
+	}
+	if len(fallback) == 0 {
+		fallback = []string{a.cfg.Reddit.Subreddit}
+	}
+	return a.router.Targets(story, fallback)
+}
+
+func newHTTPClient(cfg *Config) *http.Client {
 	transport := &http.Transport{
 		MaxIdleConns:          10,
 		IdleConnTimeout:       90 * time.Second,
@@ -468,7 +836,7 @@ func newBot() (reddit.Bot, error) {
 
 	client := &http.Client{
 		Transport: transport,
-		Timeout:   time.Second * REDDIT_TIMEOUT,
+		Timeout:   cfg.Reddit.Timeout,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) >= 10 {
 				return errors.New("too many redirects")
@@ -477,19 +845,26 @@ func newBot() (reddit.Bot, error) {
 		},
 	}
 
-	cfg := reddit.BotConfig{
-		Agent: REDDIT_AGENT,
+	return client
+}
+
+// newBot logs in to Reddit with graw. Its requests are paced by limiter;
+// graw also keeps them at least a second apart whatever it is given.
+func newBot(cfg *Config, client *http.Client, limiter *RateLimiter) (reddit.Bot, error) {
+	logger.Println("Getting Reddit bot")
+
+	botCfg := reddit.BotConfig{
+		Agent: cfg.Reddit.Agent,
 		App: reddit.App{
-			ID:       REDDIT_ID,
-			Username: REDDIT_USERNAME,
-			Secret:   secret,
-			Password: password,
+			ID:       cfg.Reddit.ClientID,
+			Username: cfg.Reddit.Username,
+			Secret:   cfg.Reddit.Secret,
+			Password: cfg.Reddit.Password,
 		},
-		Rate:   1 * time.Second,
-		Client: client,
+		Client: limiter.Client(client),
 	}
 
-	bot, err := reddit.NewBot(cfg)
+	bot, err := reddit.NewBot(botCfg)
 	if err != nil {
 		var urlErr *url.Error
 		if errors.As(err, &urlErr) {
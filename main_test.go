@@ -13,32 +13,32 @@ func TestNormalizeRedditURL(t *testing.T) {
 		{
 			name:     "Full Reddit URL with share parameters",
 			input:    "https://www.reddit.com/r/degoogle/comments/1mau7yl/eu_age_verification_app_to_ban_any_android_system/?share_id=iR05aexja3cz3w-ITsqz1&utm_content=2&utm_medium=android_app&utm_name=androidcss&utm_source=share&utm_term=1",
-			expected: "1mau7yl",
+			expected: "reddit.com/comments/1mau7yl",
 		},
 		{
 			name:     "Reddit URL without parameters",
 			input:    "https://www.reddit.com/r/degoogle/comments/1mau7yl/eu_age_verification_app_to_ban_any_android_system/",
-			expected: "1mau7yl",
+			expected: "reddit.com/comments/1mau7yl",
 		},
 		{
 			name:     "Reddit URL without www",
 			input:    "https://reddit.com/r/hackernews/comments/1mbdi2k/some_title",
-			expected: "1mbdi2k",
+			expected: "reddit.com/comments/1mbdi2k",
 		},
 		{
 			name:     "Old Reddit URL",
 			input:    "https://old.reddit.com/r/hackernews/comments/1mbdi2k/",
-			expected: "1mbdi2k",
+			expected: "reddit.com/comments/1mbdi2k",
 		},
 		{
 			name:     "Short Reddit URL",
 			input:    "https://redd.it/1mbdi2k",
-			expected: "1mbdi2k",
+			expected: "reddit.com/comments/1mbdi2k",
 		},
 		{
 			name:     "Shared link format",
 			input:    "https://www.reddit.com/r/degoogle/s/YxmPgFes8a",
-			expected: "https://www.reddit.com/r/degoogle/s/YxmPgFes8a",
+			expected: "reddit.com/s/YxmPgFes8a",
 		},
 		{
 			name:     "Non-Reddit URL",
@@ -94,9 +94,9 @@ func TestNormalizeURL(t *testing.T) {
 			expected: "https://thingino.com/path",
 		},
 		{
-			name:     "With query parameters",
+			name:     "With tracking query parameters",
 			input:    "https://www.thingino.com/page?utm_source=test",
-			expected: "https://thingino.com/page?utm_source=test",
+			expected: "https://thingino.com/page",
 		},
 		{
 			name:     "With fragment",
@@ -126,7 +126,7 @@ func TestNormalizeURL(t *testing.T) {
 		{
 			name:     "Reddit URL uses Reddit normalization",
 			input:    "https://www.reddit.com/r/test/comments/123abc/title/",
-			expected: "123abc",
+			expected: "reddit.com/comments/123abc",
 		},
 	}
 
@@ -140,6 +140,81 @@ func TestNormalizeURL(t *testing.T) {
 	}
 }
 
+func TestNormalizeURLQueryPolicy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "YouTube playlist keeps list ID",
+			input:    "https://www.youtube.com/playlist?list=PL123&feature=share&si=abc",
+			expected: "https://youtube.com/playlist?list=PL123",
+		},
+		{
+			name:     "Mobile YouTube inherits rule",
+			input:    "https://m.youtube.com/playlist?list=PL123&t=42",
+			expected: "https://m.youtube.com/playlist?list=PL123",
+		},
+		{
+			name:     "HN item keeps ID",
+			input:    "https://news.ycombinator.com/item?id=40000000&p=2",
+			expected: "https://news.ycombinator.com/item?id=40000000",
+		},
+		{
+			name:     "Tracking parameters dropped, meaningful kept",
+			input:    "https://example.com/search?q=go&utm_medium=email&fbclid=xyz&gclid=1&ref=hn",
+			expected: "https://example.com/search?q=go",
+		},
+		{
+			name:     "Parameter order does not matter",
+			input:    "https://example.com/view?b=2&a=1",
+			expected: "https://example.com/view?a=1&b=2",
+		},
+		{
+			name:     "Host rule with no identifying keys drops everything",
+			input:    "https://medium.com/@someone/post-123?source=rss&sk=abc",
+			expected: "https://medium.com/@someone/post-123",
+		},
+		{
+			name:     "Share ID dropped",
+			input:    "https://example.com/post?share_id=iR05aexja3cz3w",
+			expected: "https://example.com/post",
+		},
+		{
+			name:     "Unparseable query is kept",
+			input:    "https://example.com/a?utm_source=hn&id=1;x=2",
+			expected: "https://example.com/a?id=1;x=2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := normalizeURL(tc.input)
+			if result != tc.expected {
+				t.Errorf("normalizeURL(%q) = %q, want %q", tc.input, result, tc.expected)
+			}
+		})
+	}
+
+	// These used to collapse to the same string and cause false duplicates.
+	distinct := [][2]string{
+		{"https://www.youtube.com/watch?v=A", "https://www.youtube.com/watch?v=B"},
+		{"https://news.ycombinator.com/item?id=1", "https://news.ycombinator.com/item?id=2"},
+		{"https://example.com/article.php?id=10", "https://example.com/article.php?id=11"},
+		{"https://example.com/a?id=1;x=2", "https://example.com/a?id=2;x=2"},
+		{"https://github.com/org/repo/issues?q=is:open", "https://github.com/org/repo/issues?q=is:closed"},
+		{"https://github.com/org/repo/pulls?tab=open", "https://github.com/org/repo/pulls?tab=closed"},
+	}
+	for _, pair := range distinct {
+		t.Run("Distinct "+pair[0]+" "+pair[1], func(t *testing.T) {
+			if normalizeURL(pair[0]) == normalizeURL(pair[1]) {
+				t.Errorf("%q and %q should not normalize to the same URL", pair[0], pair[1])
+			}
+		})
+	}
+}
+
 func TestDuplicateDetection(t *testing.T) {
 	// Simulate existing posts map
 	existingLinks := make(map[string]bool)
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// trackingParams are query keys that never change what a URL points at.
+var trackingParams = map[string]bool{
+	"fbclid":               true,
+	"gclid":                true,
+	"dclid":                true,
+	"msclkid":              true,
+	"yclid":                true,
+	"twclid":               true,
+	"igshid":               true,
+	"mc_cid":               true,
+	"mc_eid":               true,
+	"_hsenc":               true,
+	"_hsmi":                true,
+	"ref":                  true,
+	"ref_src":              true,
+	"ref_url":              true,
+	"referrer":             true,
+	"share_id":             true,
+	"si":                   true,
+	"via":                  true,
+	"cmpid":                true,
+	"ncid":                 true,
+	"sr_share":             true,
+	"smid":                 true,
+	"spm":                  true,
+	"trk":                  true,
+	"__twitter_impression": true,
+}
+
+// trackingPrefixes catch whole families of tracking keys.
+var trackingPrefixes = []string{"utm_", "pk_", "mtm_", "hsa_", "oly_"}
+
+// queryRules says, per host, which query keys identify the content. For
+// these hosts every other key is dropped; hosts without a rule keep all
+// non-tracking keys. Subdomains inherit their parent's rule.
+var queryRules = map[string][]string{
+	"youtube.com":          {"v", "list"},
+	"news.ycombinator.com": {"id"},
+	"lobste.rs":            {},
+	"play.google.com":      {"id"},
+	"apps.apple.com":       {},
+	"facebook.com":         {"story_fbid", "id", "v"},
+	"bugzilla.mozilla.org": {"id"},
+	"bugs.chromium.org":    {"id"},
+	"groups.google.com":    {},
+	"twitter.com":          {},
+	"x.com":                {},
+	"medium.com":           {},
+	"substack.com":         {},
+	"nytimes.com":          {},
+	"washingtonpost.com":   {},
+	"bloomberg.com":        {},
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if trackingParams[key] {
+		return true
+	}
+	for _, prefix := range trackingPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkDomain is the lowercased host of rawURL without "www.", or "".
+func linkDomain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// parentDomains returns host followed by each of its parent domains, down
+// to the registrable two-label name: a.b.example.com, b.example.com,
+// example.com.
+func parentDomains(host string) []string {
+	var domains []string
+	for h := host; h != ""; {
+		domains = append(domains, h)
+		idx := strings.Index(h, ".")
+		if idx == -1 || !strings.Contains(h[idx+1:], ".") {
+			break
+		}
+		h = h[idx+1:]
+	}
+	return domains
+}
+
+// queryRuleFor returns the identifying keys for host, walking up through
+// parent domains until a rule is found.
+func queryRuleFor(host string) ([]string, bool) {
+	for _, h := range parentDomains(host) {
+		if keys, ok := queryRules[h]; ok {
+			return keys, true
+		}
+	}
+	return nil, false
+}
+
+// cleanQuery drops tracking and, where a host rule exists, non-identifying
+// query keys. The result is sorted by key so parameter order doesn't matter.
+func cleanQuery(host string, rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	keep, hasRule := queryRuleFor(host)
+	allowed := make(map[string]bool, len(keep))
+	for _, k := range keep {
+		allowed[k] = true
+	}
+	drop := func(key string) bool {
+		return (hasRule && !allowed[key]) || isTrackingParam(key)
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return cleanRawQuery(rawQuery, drop)
+	}
+
+	for key := range values {
+		if drop(key) {
+			delete(values, key)
+		}
+	}
+
+	return values.Encode()
+}
+
+// cleanRawQuery filters a query url.ParseQuery rejects, such as one with
+// ";" between pairs. It splits on "&" itself and keeps the remaining pairs
+// as written, since the query still tells pages apart.
+func cleanRawQuery(rawQuery string, drop func(key string) bool) string {
+	var pairs []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if !drop(key) {
+			pairs = append(pairs, pair)
+		}
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	PLAN_POST = "post"
+	PLAN_SKIP = "skip"
+)
+
+// PlanEntry is one decision processFeed made in dry-run mode.
+type PlanEntry struct {
+	Action        string `json:"action"`
+	Subreddit     string `json:"subreddit,omitempty"`
+	HNID          int    `json:"hn_id,omitempty"`
+	Title         string `json:"title"`
+	URL           string `json:"url"`
+	NormalizedURL string `json:"normalized_url,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	Body          string `json:"body,omitempty"`
+	Flair         string `json:"flair,omitempty"`
+	Comment       string `json:"comment,omitempty"`
+}
+
+// Plan collects what a run would do instead of doing it. Every method is
+// a no-op on a nil Plan, so callers don't need to check for dry-run mode.
+type Plan struct {
+	Entries []PlanEntry `json:"entries"`
+}
+
+func (p *Plan) post(subreddit string, story Story, title, normalizedLink, body, flair, comment string) {
+	if p == nil {
+		return
+	}
+	p.Entries = append(p.Entries, PlanEntry{
+		Action:        PLAN_POST,
+		Subreddit:     subreddit,
+		HNID:          story.ID,
+		Title:         title,
+		URL:           story.URL,
+		NormalizedURL: normalizedLink,
+		Body:          body,
+		Flair:         flair,
+		Comment:       comment,
+	})
+}
+
+func (p *Plan) skip(subreddit string, story Story, normalizedLink, reason string) {
+	if p == nil {
+		return
+	}
+	p.Entries = append(p.Entries, PlanEntry{
+		Action:        PLAN_SKIP,
+		Subreddit:     subreddit,
+		HNID:          story.ID,
+		Title:         story.Title,
+		URL:           story.URL,
+		NormalizedURL: normalizedLink,
+		Reason:        reason,
+	})
+}
+
+func (p *Plan) counts() (posts, comments, skips int) {
+	for _, e := range p.Entries {
+		switch e.Action {
+		case PLAN_POST:
+			posts++
+			if e.Comment != "" {
+				comments++
+			}
+		case PLAN_SKIP:
+			skips++
+		}
+	}
+	return posts, comments, skips
+}
+
+// Write renders the plan terraform-style, or as JSON.
+func (p *Plan) Write(w io.Writer, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	}
+
+	var b strings.Builder
+	b.WriteString("\nhnbot will perform the following actions:\n\n")
+
+	for _, e := range p.Entries {
+		switch e.Action {
+		case PLAN_POST:
+			fmt.Fprintf(&b, "  + post    r/%s %q\n", e.Subreddit, e.Title)
+			fmt.Fprintf(&b, "            url: %s\n", e.URL)
+			if e.HNID != 0 {
+				fmt.Fprintf(&b, "            hn:  %s\n", hnItemURL(e.HNID))
+			}
+			if e.Body != "" {
+				fmt.Fprintf(&b, "            self post, %d character body\n", utf8.RuneCountInString(e.Body))
+			}
+			if e.Flair != "" {
+				fmt.Fprintf(&b, "            flair: %s\n", e.Flair)
+			}
+			if e.Comment != "" {
+				fmt.Fprintf(&b, "    + comment %q\n", e.Comment)
+			}
+		case PLAN_SKIP:
+			if e.Subreddit != "" {
+				fmt.Fprintf(&b, "  - skip    r/%s %q\n", e.Subreddit, e.Title)
+			} else {
+				fmt.Fprintf(&b, "  - skip    %q\n", e.Title)
+			}
+			fmt.Fprintf(&b, "            url: %s\n", e.URL)
+			fmt.Fprintf(&b, "            reason: %s\n", e.Reason)
+		}
+		b.WriteString("\n")
+	}
+
+	posts, comments, skips := p.counts()
+	fmt.Fprintf(&b, "Plan: %d to post, %d to comment, %d to skip.\n", posts, comments, skips)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writePlan outputs a finished plan to cfg.PlanFile, or stdout if unset.
+func writePlan(cfg *Config, p *Plan) error {
+	if cfg.PlanFile == "" {
+		return p.Write(os.Stdout, cfg.PlanJSON)
+	}
+
+	f, err := os.Create(cfg.PlanFile)
+	if err != nil {
+		return fmt.Errorf("failed to create plan file: %w", err)
+	}
+	defer f.Close()
+
+	if err := p.Write(f, cfg.PlanJSON); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+
+	logger.Println("Plan written to", cfg.PlanFile)
+	return f.Close()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turnage/graw/reddit"
+)
+
+func TestDryRunPlan(t *testing.T) {
+	posts := []*reddit.Post{{
+		Name:       "t3_gizmo",
+		Permalink:  "/r/hackernews/comments/gizmo/gizmo/",
+		Title:      "Gizmo – a tiny build tool",
+		URL:        "https://github.com/someone/gizmo",
+		CreatedUTC: uint64(time.Now().Add(-time.Hour).Unix()),
+	}}
+	app := newTestApp(t, posts)
+	app.cfg.DryRun = true
+	app.plan = &Plan{}
+
+	stories, err := app.source.Stories(context.Background())
+	if err != nil {
+		t.Fatalf("Stories: %v", err)
+	}
+
+	// fakeBot has no GetPostLink/GetReply, so any write would panic.
+	if err := app.processFeed(context.Background(), stories); err != nil {
+		t.Fatalf("processFeed: %v", err)
+	}
+
+	if len(app.plan.Entries) != 2 {
+		t.Fatalf("got %d plan entries, want 2: %+v", len(app.plan.Entries), app.plan.Entries)
+	}
+
+	post, skip := app.plan.Entries[0], app.plan.Entries[1]
+	if post.Action != PLAN_POST || post.HNID != 100 || post.Subreddit != "hackernews" {
+		t.Errorf("unexpected post entry: %+v", post)
+	}
+	if !strings.HasPrefix(post.Comment, "Discussion on HN: https://news.ycombinator.com/item?id=100\n\n*") {
+		t.Errorf("unexpected comment: %q", post.Comment)
+	}
+	if skip.Action != PLAN_SKIP || !strings.Contains(skip.Reason, RULE_TITLE) {
+		t.Errorf("unexpected skip entry: %+v", skip)
+	}
+
+	if _, _, ok := app.store.FindPostedHN(100, "hackernews"); ok {
+		t.Error("dry run must not record posts in the store")
+	}
+
+	var text bytes.Buffer
+	if err := app.plan.Write(&text, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"+ post    r/hackernews \"A fresh story\"", "+ comment", "- skip    r/hackernews \"Show HN: Gizmo\"", "Plan: 1 to post, 1 to comment, 1 to skip."} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text plan missing %q:\n%s", want, text.String())
+		}
+	}
+
+	var js bytes.Buffer
+	if err := app.plan.Write(&js, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Plan
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatalf("JSON plan doesn't round-trip: %v", err)
+	}
+	if len(decoded.Entries) != 2 || decoded.Entries[0].URL != "https://example.com/fresh" {
+		t.Errorf("unexpected decoded plan: %+v", decoded)
+	}
+}
+
+func TestDryRunLeavesStateFile(t *testing.T) {
+	app := newTestApp(t, nil)
+	if err := app.store.RecordPost(Story{ID: 99, URL: "https://example.com/old", Title: "An old story"}, "hackernews", "t3_old"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(app.store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.cfg.DryRun = true
+	app.cfg.PlanFile = filepath.Join(t.TempDir(), "plan.txt")
+	app.store.readOnly = true // as newApp does for dry runs
+
+	if err := app.runOnce(context.Background()); err != nil {
+		t.Fatalf("runOnce: %v", err)
+	}
+
+	after, err := os.ReadFile(app.store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("dry run changed the state file")
+	}
+}
+
+func TestPlanJSONStdout(t *testing.T) {
+	app := newTestApp(t, nil)
+	app.cfg.DryRun = true
+	app.cfg.PlanJSON = true
+	app.store.readOnly = true
+
+	stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+
+	saved := os.Stdout
+	os.Stdout = stdout
+	setLogOutput(true)
+	defer func() {
+		os.Stdout = saved
+		setLogOutput(false)
+	}()
+
+	if err := app.runOnce(context.Background()); err != nil {
+		t.Fatalf("runOnce: %v", err)
+	}
+
+	out, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Plan
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("stdout isn't just the JSON plan: %v\n%s", err, out)
+	}
+	if len(decoded.Entries) == 0 {
+		t.Errorf("got an empty plan from stdout:\n%s", out)
+	}
+}
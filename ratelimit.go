@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces requests to Reddit by the X-Ratelimit-Remaining,
+// -Used and -Reset headers on its responses. What's left of the budget is
+// spread evenly over the rest of the window, and once it runs out every
+// request waits for the window to reset. The budget belongs to the OAuth
+// app and account, so one RateLimiter is shared by every Reddit client.
+type RateLimiter struct {
+	mu        sync.Mutex
+	remaining float64 // -1 until a response has said
+	used      int
+	reset     time.Time
+	next      time.Time // when the next request may go
+}
+
+func newRateLimiter() *RateLimiter {
+	return &RateLimiter{remaining: -1}
+}
+
+// Client returns a copy of c whose requests go through the limiter, or c
+// itself if l is nil. c's Timeout is moved into the transport so it only
+// starts once the limiter lets a request go; it then applies to each
+// request, redirects included, rather than to the whole exchange.
+func (l *RateLimiter) Client(c *http.Client) *http.Client {
+	if l == nil {
+		return c
+	}
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	limited := *c
+	limited.Transport = &rateLimitTransport{limiter: l, next: next, timeout: c.Timeout}
+	limited.Timeout = 0
+	return &limited
+}
+
+type rateLimitTransport struct {
+	limiter *RateLimiter
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if t.timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), t.timeout)
+		req = req.WithContext(ctx)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	t.limiter.update(resp.Header, time.Now())
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose ends a request's timeout once its body has been read.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// wait blocks until the next request may be sent or ctx is done. graw's
+// requests have no context, so theirs always run to the end; a post that
+// has started is finished, comment included, even after a shutdown signal.
+func (l *RateLimiter) wait(ctx context.Context) error {
+	d := l.reserve(time.Now())
+	if d <= 0 {
+		return nil
+	}
+
+	if d >= time.Second {
+		logger.Printf("Reddit rate limit: waiting %v (%s)\n", d.Round(time.Second), l.Budget())
+	}
+
+	if !sleepContext(ctx, d) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// reserve claims a request from the budget and returns how long after
+// now it may be sent.
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := now
+	if l.next.After(start) {
+		start = l.next
+	}
+
+	switch {
+	case l.remaining < 0 || !start.Before(l.reset):
+		// Nothing is known about this window yet.
+	case l.remaining < 1:
+		start = l.reset
+		l.next = start
+	default:
+		l.next = start.Add(time.Duration(float64(l.reset.Sub(start)) / l.remaining))
+		l.remaining--
+	}
+
+	return start.Sub(now)
+}
+
+// update records the budget a response reported.
+func (l *RateLimiter) update(h http.Header, now time.Time) {
+	remaining, err := strconv.ParseFloat(h.Get("X-Ratelimit-Remaining"), 64)
+	if err != nil {
+		return
+	}
+	reset, err := strconv.Atoi(h.Get("X-Ratelimit-Reset"))
+	if err != nil {
+		return
+	}
+	used, _ := strconv.Atoi(h.Get("X-Ratelimit-Used"))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.remaining = remaining
+	l.used = used
+	l.reset = now.Add(time.Duration(reset) * time.Second)
+}
+
+// Budget describes the current window for logging.
+func (l *RateLimiter) Budget() string {
+	if l == nil {
+		return "budget unknown"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.remaining < 0 || !time.Now().Before(l.reset) {
+		return "budget unknown"
+	}
+	return fmt.Sprintf("%d used, %.0f left, resets in %v", l.used, l.remaining, time.Until(l.reset).Round(time.Second))
+}
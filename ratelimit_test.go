@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name      string
+		remaining string
+		reset     string
+		want      []time.Duration
+	}{
+		{
+			name: "Unknown budget",
+			want: []time.Duration{0, 0, 0},
+		},
+		{
+			name:      "Budget spread over the window",
+			remaining: "4.0",
+			reset:     "8",
+			want:      []time.Duration{0, 2 * time.Second, 4 * time.Second, 6 * time.Second, 8 * time.Second},
+		},
+		{
+			name:      "Budget spent",
+			remaining: "0.0",
+			reset:     "30",
+			want:      []time.Duration{30 * time.Second, 30 * time.Second},
+		},
+		{
+			name:      "Bad headers are ignored",
+			remaining: "lots",
+			reset:     "30",
+			want:      []time.Duration{0, 0},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newRateLimiter()
+			h := http.Header{}
+			if tc.remaining != "" {
+				h.Set("X-Ratelimit-Remaining", tc.remaining)
+				h.Set("X-Ratelimit-Reset", tc.reset)
+			}
+			l.update(h, now)
+
+			for i, want := range tc.want {
+				if got := l.reserve(now); got != want {
+					t.Errorf("request %d waits %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterClient(t *testing.T) {
+	var last time.Time
+	var gap time.Duration
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !last.IsZero() {
+			gap = time.Since(last)
+		}
+		last = time.Now()
+		w.Header().Set("X-Ratelimit-Used", "600")
+		w.Header().Set("X-Ratelimit-Remaining", "0.0")
+		w.Header().Set("X-Ratelimit-Reset", "1")
+	}))
+	defer srv.Close()
+
+	l := newRateLimiter()
+	c := l.Client(srv.Client())
+	if c == srv.Client() {
+		t.Fatal("Client should return a copy")
+	}
+
+	for range 2 {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if gap < 900*time.Millisecond {
+		t.Errorf("second request came %v after the first, want it to wait for the reset", gap)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := c.Do(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want the wait to stop when ctx is done", err)
+	}
+}
+
+func TestRateLimiterClientTimeout(t *testing.T) {
+	var slow atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			time.Sleep(time.Second)
+		}
+		w.Header().Set("X-Ratelimit-Remaining", "0.0")
+		w.Header().Set("X-Ratelimit-Reset", "1")
+	}))
+	defer srv.Close()
+
+	client := srv.Client()
+	client.Timeout = 300 * time.Millisecond
+	c := newRateLimiter().Client(client)
+
+	// The second request waits out the window, longer than the timeout.
+	for i := range 2 {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		resp.Body.Close()
+	}
+
+	// The timeout still applies to the request itself.
+	slow.Store(true)
+	if _, err := newRateLimiter().Client(client).Get(srv.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want a slow response to time out", err)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedditAPI is the Reddit calls hnbot makes that graw's reddit.Bot
+// doesn't cover: editing, moderating and flairing things the bot posted.
+// Things are identified by fullname (t1_..., t3_...).
+type RedditAPI interface {
+	// EditText replaces the body of a comment or self post.
+	EditText(ctx context.Context, name, text string) error
+	// Distinguish marks a comment as a moderator's, stickying it to the
+	// top of the thread if sticky is set.
+	Distinguish(ctx context.Context, name string, sticky bool) error
+	// Sticky pins or unpins a post in its subreddit.
+	Sticky(ctx context.Context, name string, sticky bool) error
+	// Lock stops new comments on a post or comment thread.
+	Lock(ctx context.Context, name string) error
+	// Remove takes down a post or comment, optionally as spam.
+	Remove(ctx context.Context, name string, spam bool) error
+	// Approve restores a removed post or comment.
+	Approve(ctx context.Context, name string) error
+	// SelectFlair applies a link flair template to a post, optionally
+	// overriding its text.
+	SelectFlair(ctx context.Context, subreddit, name, templateID, text string) error
+	// SetFlairText sets plain flair text on a post, without a template.
+	SetFlairText(ctx context.Context, subreddit, name, text string) error
+}
+
+// RedditError is a failed Reddit API call: an HTTP error status, or the
+// first entry of the error list Reddit returns with a 200. Err is the
+// original error, when it came from graw.
+type RedditError struct {
+	Path       string
+	StatusCode int
+	Code       string
+	Message    string
+	Field      string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RedditError) Error() string {
+	msg := fmt.Sprintf("Reddit %s: ", e.Path)
+	switch {
+	case e.Code != "":
+		msg += e.Code
+		if e.Message != "" {
+			msg += ": " + e.Message
+		}
+		if e.Field != "" {
+			msg += " (" + e.Field + ")"
+		}
+	case e.StatusCode != 0:
+		msg += fmt.Sprintf("HTTP %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	default:
+		msg += e.Message
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry after %v", e.RetryAfter)
+	}
+	return msg
+}
+
+func (e *RedditError) Unwrap() error {
+	return e.Err
+}
+
+// RedditClient is a small OAuth client for the Reddit API. It logs in as
+// the bot's script app, with a refresh token if one is configured and
+// otherwise with the account password. Rate limiting is left to the
+// client it is given; see RateLimiter.
+type RedditClient struct {
+	client       *http.Client
+	agent        string
+	clientID     string
+	secret       string
+	username     string
+	password     string
+	refreshToken string
+	tokenURL     string
+	apiURL       string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newRedditClient(cfg *Config, client *http.Client) *RedditClient {
+	return &RedditClient{
+		client:       client,
+		agent:        cfg.Reddit.Agent,
+		clientID:     cfg.Reddit.ClientID,
+		secret:       cfg.Reddit.Secret,
+		username:     cfg.Reddit.Username,
+		password:     cfg.Reddit.Password,
+		refreshToken: cfg.Reddit.RefreshToken,
+		tokenURL:     cfg.Reddit.TokenURL,
+		apiURL:       strings.TrimSuffix(cfg.Reddit.APIURL, "/"),
+	}
+}
+
+// accessToken returns a cached token, logging in again shortly before it
+// expires.
+func (r *RedditClient) accessToken(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.token != "" && time.Now().Before(r.expires) {
+		return r.token, nil
+	}
+
+	form := url.Values{
+		"grant_type": {"password"},
+		"username":   {r.username},
+		"password":   {r.password},
+	}
+	if r.refreshToken != "" {
+		form = url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {r.refreshToken},
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(r.clientID, r.secret)
+	req.Header.Set("User-Agent", r.agent)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Reddit access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("failed to decode Reddit access token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return "", &RedditError{Path: "access_token", StatusCode: resp.StatusCode, Code: tok.Error}
+	}
+
+	r.token = tok.AccessToken
+	r.expires = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return r.token, nil
+}
+
+// forgetToken drops a token Reddit rejected so the next call logs in again.
+func (r *RedditClient) forgetToken(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.token == token {
+		r.token = ""
+	}
+}
+
+// post sends form to an API endpoint, logging in again once if the token
+// was rejected, and returns a *RedditError for HTTP errors and for the
+// api_type=json error list.
+func (r *RedditClient) post(ctx context.Context, path string, form url.Values) error {
+	form.Set("api_type", "json")
+
+	err := r.doPost(ctx, path, form)
+	var rerr *RedditError
+	if errors.As(err, &rerr) && rerr.StatusCode == http.StatusUnauthorized {
+		err = r.doPost(ctx, path, form)
+	}
+	return err
+}
+
+func (r *RedditClient) doPost(ctx context.Context, path string, form url.Values) error {
+	token, err := r.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.apiURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("User-Agent", r.agent)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Reddit %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("Reddit %s: %w", path, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		rerr := &RedditError{Path: path, StatusCode: resp.StatusCode}
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			r.forgetToken(token)
+		case http.StatusTooManyRequests:
+			if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				rerr.RetryAfter = time.Duration(secs) * time.Second
+			}
+		}
+		return rerr
+	}
+
+	var result struct {
+		JSON struct {
+			Errors [][]any `json:"errors"`
+		} `json:"json"`
+	}
+	if len(body) > 0 && json.Unmarshal(body, &result) == nil && len(result.JSON.Errors) > 0 {
+		return redditErrorFromList(path, result.JSON.Errors[0])
+	}
+
+	return nil
+}
+
+// redditErrorFromList parses one [code, message, field] error entry.
+func redditErrorFromList(path string, entry []any) *RedditError {
+	rerr := &RedditError{Path: path}
+	for i, v := range entry {
+		s, _ := v.(string)
+		switch i {
+		case 0:
+			rerr.Code = s
+		case 1:
+			rerr.Message = s
+			rerr.RetryAfter = retryAfterFromMessage(s)
+		case 2:
+			rerr.Field = s
+		}
+	}
+	return rerr
+}
+
+func (r *RedditClient) EditText(ctx context.Context, name, text string) error {
+	return r.post(ctx, "/api/editusertext", url.Values{
+		"thing_id": {name},
+		"text":     {text},
+	})
+}
+
+func (r *RedditClient) Distinguish(ctx context.Context, name string, sticky bool) error {
+	return r.post(ctx, "/api/distinguish", url.Values{
+		"id":     {name},
+		"how":    {"yes"},
+		"sticky": {strconv.FormatBool(sticky)},
+	})
+}
+
+func (r *RedditClient) Sticky(ctx context.Context, name string, sticky bool) error {
+	return r.post(ctx, "/api/set_subreddit_sticky", url.Values{
+		"id":    {name},
+		"state": {strconv.FormatBool(sticky)},
+	})
+}
+
+func (r *RedditClient) Lock(ctx context.Context, name string) error {
+	return r.post(ctx, "/api/lock", url.Values{"id": {name}})
+}
+
+func (r *RedditClient) Remove(ctx context.Context, name string, spam bool) error {
+	return r.post(ctx, "/api/remove", url.Values{
+		"id":   {name},
+		"spam": {strconv.FormatBool(spam)},
+	})
+}
+
+func (r *RedditClient) Approve(ctx context.Context, name string) error {
+	return r.post(ctx, "/api/approve", url.Values{"id": {name}})
+}
+
+func (r *RedditClient) SelectFlair(ctx context.Context, subreddit, name, templateID, text string) error {
+	if templateID == "" {
+		return errors.New("flair template ID is empty")
+	}
+	form := url.Values{
+		"link":              {name},
+		"flair_template_id": {templateID},
+	}
+	if text != "" {
+		form.Set("text", text)
+	}
+	return r.post(ctx, "/r/"+subreddit+"/api/selectflair", form)
+}
+
+func (r *RedditClient) SetFlairText(ctx context.Context, subreddit, name, text string) error {
+	return r.post(ctx, "/r/"+subreddit+"/api/flair", url.Values{
+		"link": {name},
+		"text": {text},
+	})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedditAPI records every call as "Method arg arg..." and fails those
+// listed in fail.
+type fakeRedditAPI struct {
+	mu    sync.Mutex
+	calls []string
+	fail  map[string]error
+}
+
+func (f *fakeRedditAPI) call(method string, args ...any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, strings.TrimSpace(fmt.Sprintln(append([]any{method}, args...)...)))
+	return f.fail[method]
+}
+
+func (f *fakeRedditAPI) EditText(ctx context.Context, name, text string) error {
+	return f.call("EditText", name, text)
+}
+
+func (f *fakeRedditAPI) Distinguish(ctx context.Context, name string, sticky bool) error {
+	return f.call("Distinguish", name, sticky)
+}
+
+func (f *fakeRedditAPI) Sticky(ctx context.Context, name string, sticky bool) error {
+	return f.call("Sticky", name, sticky)
+}
+
+func (f *fakeRedditAPI) Lock(ctx context.Context, name string) error {
+	return f.call("Lock", name)
+}
+
+func (f *fakeRedditAPI) Remove(ctx context.Context, name string, spam bool) error {
+	return f.call("Remove", name, spam)
+}
+
+func (f *fakeRedditAPI) Approve(ctx context.Context, name string) error {
+	return f.call("Approve", name)
+}
+
+func (f *fakeRedditAPI) SelectFlair(ctx context.Context, subreddit, name, templateID, text string) error {
+	return f.call("SelectFlair", subreddit, name, templateID, text)
+}
+
+func (f *fakeRedditAPI) SetFlairText(ctx context.Context, subreddit, name, text string) error {
+	return f.call("SetFlairText", subreddit, name, text)
+}
+
+func newTestRedditClient(t *testing.T, handler http.HandlerFunc) *RedditClient {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cfg := defaultConfig()
+	cfg.Reddit.ClientID = "client"
+	cfg.Reddit.Secret = "secret"
+	cfg.Reddit.Password = "password"
+	cfg.Reddit.TokenURL = srv.URL + "/api/v1/access_token"
+	cfg.Reddit.APIURL = srv.URL
+	return newRedditClient(cfg, srv.Client())
+}
+
+func TestRedditClientLogin(t *testing.T) {
+	tokens := 0
+	c := newTestRedditClient(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/api/v1/access_token":
+			tokens++
+			user, pass, _ := r.BasicAuth()
+			if user != "client" || pass != "secret" {
+				t.Errorf("token request authenticated as %s:%s", user, pass)
+			}
+			fmt.Fprintf(w, `{"access_token":"tok%d","expires_in":3600}`, tokens)
+		case "/api/lock":
+			// The first token has been revoked.
+			if r.Header.Get("Authorization") == "bearer tok1" {
+				http.Error(w, "", http.StatusUnauthorized)
+				return
+			}
+			if r.Form.Get("id") != "t3_abc" || r.Form.Get("api_type") != "json" {
+				t.Errorf("unexpected lock request: %v", r.Form)
+			}
+			fmt.Fprint(w, `{}`)
+		}
+	})
+
+	if err := c.Lock(context.Background(), "t3_abc"); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if tokens != 2 {
+		t.Errorf("got %d token requests, want a second login after the 401", tokens)
+	}
+
+	if err := c.Lock(context.Background(), "t3_abc"); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if tokens != 2 {
+		t.Errorf("got %d token requests, want the token reused", tokens)
+	}
+}
+
+func TestRedditClientRefreshToken(t *testing.T) {
+	c := newTestRedditClient(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path == "/api/v1/access_token" {
+			if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "refresh" || r.Form.Has("password") {
+				t.Errorf("unexpected token request: %v", r.Form)
+			}
+			fmt.Fprint(w, `{"access_token":"tok","expires_in":3600}`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	})
+	c.refreshToken = "refresh"
+
+	if err := c.Approve(context.Background(), "t1_abc"); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+}
+
+func TestRedditClientErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    RedditError
+	}{
+		{
+			name: "Error list",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"json":{"errors":[["RATELIMIT","you are doing that too much","ratelimit"]]}}`)
+			},
+			want: RedditError{Path: "/api/editusertext", Code: "RATELIMIT", Message: "you are doing that too much", Field: "ratelimit"},
+		},
+		{
+			name: "Too many requests",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "30")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			want: RedditError{Path: "/api/editusertext", StatusCode: http.StatusTooManyRequests, RetryAfter: 30 * time.Second},
+		},
+		{
+			name: "Forbidden",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			},
+			want: RedditError{Path: "/api/editusertext", StatusCode: http.StatusForbidden},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestRedditClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/api/v1/access_token" {
+					fmt.Fprint(w, `{"access_token":"tok","expires_in":3600}`)
+					return
+				}
+				tc.handler(w, r)
+			})
+
+			err := c.EditText(context.Background(), "t1_abc", "hello")
+			var rerr *RedditError
+			if !errors.As(err, &rerr) {
+				t.Fatalf("got %v, want a *RedditError", err)
+			}
+			if *rerr != tc.want {
+				t.Errorf("got %+v, want %+v", *rerr, tc.want)
+			}
+		})
+	}
+}
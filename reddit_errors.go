@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/turnage/graw/reddit"
+)
+
+// Reddit API error codes hnbot recovers from.
+const (
+	REDDIT_ALREADY_SUB   = "ALREADY_SUB"
+	REDDIT_RATELIMIT     = "RATELIMIT"
+	REDDIT_DOMAIN_BANNED = "DOMAIN_BANNED"
+)
+
+// MAX_RATELIMIT_WAIT is the longest a submission waits out a rate limit.
+// Longer limits end the run; the next one picks up where it stopped.
+const MAX_RATELIMIT_WAIT = 10 * time.Minute
+
+// DOMAIN_QUARANTINE is how long stories from a domain Reddit banned in a
+// subreddit are skipped there before the bot tries again.
+const DOMAIN_QUARANTINE = 30 * 24 * time.Hour
+
+var (
+	// graw formats API errors with %v, e.g.
+	// "API errors were returned: [[ALREADY_SUB that link has already been submitted url]]".
+	grawAPIErrorRegex = regexp.MustCompile(`API errors were returned: \[\[(\w+) ?([^\]]*)\]`)
+	grawStatusRegex   = regexp.MustCompile(`bad response code: (\d{3})`)
+	errorFieldRegex   = regexp.MustCompile(` ([a-z_]+|<nil>)$`)
+	retryInRegex      = regexp.MustCompile(`(?i)try again in (\d+) (millisecond|second|minute|hour)`)
+)
+
+// RateLimited reports whether Reddit asked the bot to slow down.
+func (e *RedditError) RateLimited() bool {
+	return e.Code == REDDIT_RATELIMIT || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Fatal reports whether the bot can't post at all, so there's no point
+// carrying on with the run. A 403 isn't: it is usually one subreddit
+// banning the bot or not approving it as a submitter.
+func (e *RedditError) Fatal() bool {
+	return e.StatusCode == http.StatusUnauthorized
+}
+
+// classifyRedditError turns an error from graw or RedditClient into a
+// *RedditError, wrapping the original. It returns nil for errors that
+// didn't come from Reddit, such as network failures.
+func classifyRedditError(path string, err error) *RedditError {
+	if err == nil {
+		return nil
+	}
+
+	var rerr *RedditError
+	if errors.As(err, &rerr) {
+		return rerr
+	}
+
+	rerr = &RedditError{Path: path, Err: err}
+	switch {
+	case errors.Is(err, reddit.PermissionDeniedErr):
+		rerr.StatusCode = http.StatusForbidden
+	case errors.Is(err, reddit.RateLimitErr):
+		rerr.StatusCode = http.StatusTooManyRequests
+	case errors.Is(err, reddit.BusyErr):
+		rerr.StatusCode = http.StatusServiceUnavailable
+	case errors.Is(err, reddit.GatewayErr):
+		rerr.StatusCode = http.StatusBadGateway
+	case errors.Is(err, reddit.GatewayTimeoutErr):
+		rerr.StatusCode = http.StatusGatewayTimeout
+	default:
+		msg := err.Error()
+		if m := grawAPIErrorRegex.FindStringSubmatch(msg); m != nil {
+			rerr.Code = m[1]
+			rerr.Message = m[2]
+			if f := errorFieldRegex.FindStringSubmatch(rerr.Message); f != nil {
+				// A null field comes through as "<nil>".
+				if f[1] != "<nil>" {
+					rerr.Field = f[1]
+				}
+				rerr.Message = strings.TrimSuffix(rerr.Message, f[0])
+			}
+			rerr.RetryAfter = retryAfterFromMessage(rerr.Message)
+		} else if m := grawStatusRegex.FindStringSubmatch(msg); m != nil {
+			rerr.StatusCode, _ = strconv.Atoi(m[1])
+		} else {
+			return nil
+		}
+	}
+	return rerr
+}
+
+// retryAfterFromMessage reads the wait out of a RATELIMIT message such as
+// "you are doing that too much. try again in 7 minutes."
+func retryAfterFromMessage(msg string) time.Duration {
+	m := retryInRegex.FindStringSubmatch(msg)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	unit := map[string]time.Duration{
+		"millisecond": time.Millisecond,
+		"second":      time.Second,
+		"minute":      time.Minute,
+		"hour":        time.Hour,
+	}[strings.ToLower(m[2])]
+	return time.Duration(n) * unit
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/turnage/graw/reddit"
+)
+
+func TestClassifyRedditError(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want *RedditError
+	}{
+		{
+			name: "Already submitted",
+			err:  errors.New("API errors were returned: [[ALREADY_SUB that link has already been submitted url]]"),
+			want: &RedditError{Code: REDDIT_ALREADY_SUB, Message: "that link has already been submitted", Field: "url"},
+		},
+		{
+			name: "Rate limit with wait",
+			err:  errors.New("API errors were returned: [[RATELIMIT you are doing that too much. try again in 7 minutes. ratelimit]]"),
+			want: &RedditError{Code: REDDIT_RATELIMIT, Message: "you are doing that too much. try again in 7 minutes.", Field: "ratelimit", RetryAfter: 7 * time.Minute},
+		},
+		{
+			name: "Banned domain",
+			err:  errors.New("API errors were returned: [[DOMAIN_BANNED example.com is not allowed url]]"),
+			want: &RedditError{Code: REDDIT_DOMAIN_BANNED, Message: "example.com is not allowed", Field: "url"},
+		},
+		{
+			name: "Null field",
+			err:  errors.New("API errors were returned: [[SUBREDDIT_NOTALLOWED you aren't allowed to post there. <nil>]]"),
+			want: &RedditError{Code: "SUBREDDIT_NOTALLOWED", Message: "you aren't allowed to post there."},
+		},
+		{
+			name: "Too many requests",
+			err:  reddit.RateLimitErr,
+			want: &RedditError{StatusCode: http.StatusTooManyRequests},
+		},
+		{
+			name: "Forbidden",
+			err:  reddit.PermissionDeniedErr,
+			want: &RedditError{StatusCode: http.StatusForbidden},
+		},
+		{
+			name: "Unauthorized",
+			err:  errors.New("bad response code: 401"),
+			want: &RedditError{StatusCode: http.StatusUnauthorized},
+		},
+		{
+			name: "Network error",
+			err:  errors.New("dial tcp: connection refused"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := classifyRedditError("submit", tc.err)
+			if tc.want == nil {
+				if got != nil {
+					t.Fatalf("got %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("got nil")
+			}
+			if got.Code != tc.want.Code || got.Message != tc.want.Message || got.Field != tc.want.Field ||
+				got.StatusCode != tc.want.StatusCode || got.RetryAfter != tc.want.RetryAfter {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+			if !errors.Is(got, tc.err) {
+				t.Error("classified error should wrap the original")
+			}
+		})
+	}
+}
+
+// submitBot fails GetPostLink with each of errs in turn, then succeeds.
+type submitBot struct {
+	fakeBot
+	errs  []error
+	calls int
+}
+
+func (b *submitBot) GetPostLink(subreddit, title, url string) (reddit.Submission, error) {
+	b.calls++
+	if len(b.errs) > 0 {
+		err := b.errs[0]
+		b.errs = b.errs[1:]
+		return reddit.Submission{}, err
+	}
+	return reddit.Submission{Name: "t3_new"}, nil
+}
+
+func TestSubmitRecovery(t *testing.T) {
+	story := Story{ID: 1, Title: "A story", URL: "https://blocked.example.com/a"}
+
+	testCases := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+		check     func(t *testing.T, st *Store)
+	}{
+		{
+			name:      "Short rate limit is waited out",
+			errs:      []error{errors.New("API errors were returned: [[RATELIMIT try again in 10 milliseconds. ratelimit]]")},
+			wantCalls: 2,
+		},
+		{
+			name:      "Long rate limit gives up",
+			errs:      []error{errors.New("API errors were returned: [[RATELIMIT try again in 2 hours. ratelimit]]")},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "Already submitted is recorded",
+			errs:      []error{errors.New("API errors were returned: [[ALREADY_SUB that link has already been submitted url]]")},
+			wantCalls: 1,
+			check: func(t *testing.T, st *Store) {
+				if _, _, ok := st.FindPostedHN(1, "hackernews"); !ok {
+					t.Error("story should be recorded as posted")
+				}
+			},
+		},
+		{
+			name:      "Banned domain is quarantined",
+			errs:      []error{errors.New("API errors were returned: [[DOMAIN_BANNED blocked.example.com is not allowed url]]")},
+			wantCalls: 1,
+			check: func(t *testing.T, st *Store) {
+				if !st.DomainBanned("HackerNews", "blocked.example.com") {
+					t.Error("domain should be quarantined")
+				}
+			},
+		},
+		{
+			name:      "Forbidden is returned",
+			errs:      []error{reddit.PermissionDeniedErr},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatalf("openStore: %v", err)
+			}
+			bot := &submitBot{errs: tc.errs}
+			app := &App{cfg: defaultConfig(), bot: bot, store: st}
+
+			_, err = app.submit(context.Background(), "hackernews", story.Title, story, "")
+			if err != nil {
+				err = app.submitFailed("hackernews", story, err)
+			}
+
+			if (err != nil) != tc.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tc.wantErr)
+			}
+			if bot.calls != tc.wantCalls {
+				t.Errorf("made %d submissions, want %d", bot.calls, tc.wantCalls)
+			}
+			if tc.check != nil {
+				tc.check(t, st)
+			}
+		})
+	}
+}
+
+// routedBot refuses submissions to r/closed and accepts the rest.
+type routedBot struct {
+	fakeBot
+	submitted []string
+}
+
+func (b *routedBot) GetPostLink(subreddit, title, url string) (reddit.Submission, error) {
+	b.submitted = append(b.submitted, subreddit)
+	if subreddit == "closed" {
+		return reddit.Submission{}, reddit.PermissionDeniedErr
+	}
+	return reddit.Submission{Name: fmt.Sprintf("t3_%d", len(b.submitted))}, nil
+}
+
+func (b *routedBot) GetReply(parentName, text string) (reddit.Submission, error) {
+	return reddit.Submission{Name: "t1_" + parentName}, nil
+}
+
+func TestForbiddenSubredditIsSkipped(t *testing.T) {
+	app := newTestApp(t, nil)
+	bot := &routedBot{}
+	app.bot = bot
+	app.api = &fakeRedditAPI{}
+	app.cfg.Routes = []RouteConfig{{Subreddits: []string{"closed", "open"}}}
+	router, err := newRouter(app.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.router = router
+
+	now := time.Now()
+	stories := []Story{
+		{ID: 1, Title: "First story", URL: "https://example.com/1", Time: now},
+		{ID: 2, Title: "Second story", URL: "https://example.com/2", Time: now},
+	}
+	if err := app.processFeed(context.Background(), stories); err != nil {
+		t.Fatalf("processFeed: %v", err)
+	}
+
+	if want := []string{"closed", "open", "open"}; !slices.Equal(bot.submitted, want) {
+		t.Errorf("submitted to %q, want %q", bot.submitted, want)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NORMALIZE_WORKERS caps how many links normalizeAll looks up at once.
+const NORMALIZE_WORKERS = 8
+
+// Resolver follows redirects for shortened links so dedupe compares the
+// article rather than the shortener. Results are cached in the store.
+// A nil Resolver leaves every URL as it is.
+type Resolver struct {
+	client  *http.Client
+	store   *Store
+	agent   string
+	timeout time.Duration
+	hosts   map[string]bool
+}
+
+// newResolver shares client's transport but caps redirects at
+// cfg.MaxRedirects. It returns nil when resolution is disabled.
+func newResolver(cfg *Config, client *http.Client, st *Store) *Resolver {
+	if !cfg.Resolve.Enabled {
+		return nil
+	}
+
+	bounded := *client
+	bounded.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= cfg.Resolve.MaxRedirects {
+			return errors.New("too many redirects")
+		}
+		return nil
+	}
+
+	hosts := make(map[string]bool, len(cfg.Resolve.Hosts))
+	for _, h := range cfg.Resolve.Hosts {
+		hosts[strings.ToLower(h)] = true
+	}
+
+	return &Resolver{
+		client:  &bounded,
+		store:   st,
+		agent:   cfg.Reddit.Agent,
+		timeout: cfg.Resolve.Timeout,
+		hosts:   hosts,
+	}
+}
+
+// needsResolving reports whether u is a shortener or redirector link.
+// redd.it/<id> isn't listed since normalizeRedditURL handles it offline,
+// but reddit.com/r/<sub>/s/<id> share links only resolve over HTTP.
+func (r *Resolver) needsResolving(u *url.URL) bool {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+
+	for _, h := range parentDomains(host) {
+		if r.hosts[h] {
+			return true
+		}
+	}
+
+	if (host == "reddit.com" || strings.HasSuffix(host, ".reddit.com")) && strings.Contains(u.Path, "/s/") {
+		return true
+	}
+
+	return false
+}
+
+// Resolve returns the final URL rawURL redirects to, or rawURL itself if
+// it isn't a known shortener or can't be resolved.
+func (r *Resolver) Resolve(ctx context.Context, rawURL string) string {
+	if r == nil || rawURL == "" {
+		return rawURL
+	}
+
+	if final, ok := r.store.Resolved(rawURL); ok {
+		return final
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || !r.needsResolving(u) {
+		return rawURL
+	}
+
+	final, err := r.follow(ctx, rawURL)
+	if err != nil {
+		logger.Printf("Warning: failed to resolve %s: %v\n", rawURL, err)
+		return rawURL
+	}
+
+	if final != rawURL {
+		logger.Printf("Resolved %s -> %s\n", rawURL, final)
+	}
+
+	r.store.SetResolved(rawURL, final)
+
+	return final
+}
+
+// follow tries a HEAD first and falls back to GET for servers that refuse
+// HEAD. The GET body is never read.
+func (r *Resolver) follow(ctx context.Context, rawURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var lastErr error
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("User-Agent", r.agent)
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 400 {
+			lastErr = fmt.Errorf("%s returned %s", method, resp.Status)
+			continue
+		}
+
+		return resp.Request.URL.String(), nil
+	}
+
+	return "", lastErr
+}
+
+// normalize resolves rawURL if needed, swaps in the page's canonical URL
+// if enabled, and normalizes the result.
+func (a *App) normalize(ctx context.Context, rawURL string) string {
+	resolved := a.resolver.Resolve(ctx, rawURL)
+	return normalizeURL(a.canonical.Canonical(ctx, resolved))
+}
+
+// normalizeAll normalizes every link like normalize, with at most
+// NORMALIZE_WORKERS lookups in flight. Each distinct link is looked up
+// once.
+func (a *App) normalizeAll(ctx context.Context, rawURLs []string) []string {
+	var unique []string
+	seen := make(map[string]bool, len(rawURLs))
+	for _, u := range rawURLs {
+		if !seen[u] {
+			seen[u] = true
+			unique = append(unique, u)
+		}
+	}
+
+	results := make([]string, len(unique))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, min(NORMALIZE_WORKERS, len(unique))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = a.normalize(ctx, unique[i])
+			}
+		}()
+	}
+
+	for i := range unique {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	byURL := make(map[string]string, len(unique))
+	for i, u := range unique {
+		byURL[u] = results[i]
+	}
+	normalized := make([]string, len(rawURLs))
+	for i, u := range rawURLs {
+		normalized[i] = byURL[u]
+	}
+	return normalized
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestResolver(t *testing.T, hosts ...string) (*Resolver, *Store) {
+	t.Helper()
+
+	st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	cfg := defaultConfig()
+	cfg.Resolve.Enabled = true
+	cfg.Resolve.Hosts = hosts
+
+	return newResolver(cfg, newHTTPClient(cfg), st), st
+}
+
+func TestResolverFollowsAndCaches(t *testing.T) {
+	var hits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/short", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Redirect(w, r, "/article?utm_source=short", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	r, st := newTestResolver(t, "127.0.0.1")
+
+	got := r.Resolve(context.Background(), srv.URL+"/short")
+	if want := srv.URL + "/article?utm_source=short"; got != want {
+		t.Fatalf("Resolve = %q, want %q", got, want)
+	}
+
+	r.Resolve(context.Background(), srv.URL+"/short")
+	if n := hits.Load(); n != 1 {
+		t.Errorf("shortener hit %d times, want 1 (second lookup should be cached)", n)
+	}
+
+	if _, ok := st.Resolved(srv.URL + "/short"); !ok {
+		t.Error("resolution not cached in store")
+	}
+}
+
+func TestResolverFallsBackToGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path == "/s/abc" {
+			http.Redirect(w, r, "/final", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	r, _ := newTestResolver(t, "127.0.0.1")
+
+	if got, want := r.Resolve(context.Background(), srv.URL+"/s/abc"), srv.URL+"/final"; got != want {
+		t.Errorf("Resolve = %q, want %q", got, want)
+	}
+}
+
+func TestResolverSkipsUnlistedHosts(t *testing.T) {
+	r, _ := newTestResolver(t, "t.co")
+
+	for _, raw := range []string{
+		"https://example.com/article",
+		"https://redd.it/1mbdi2k",
+	} {
+		if got := r.Resolve(context.Background(), raw); got != raw {
+			t.Errorf("Resolve(%q) = %q, want it untouched", raw, got)
+		}
+	}
+
+	u := mustParse(t, "https://www.reddit.com/r/degoogle/s/YxmPgFes8a")
+	if !r.needsResolving(u) {
+		t.Error("Reddit share links should be resolved")
+	}
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// storyMatcher is a compiled StoryMatch.
+type storyMatcher struct {
+	types       []string
+	titlePrefix string
+	domains     []string
+	keyword     *regexp.Regexp
+}
+
+// newStoryMatcher compiles m. extraDomains are matched as if listed in
+// m.Domains.
+func newStoryMatcher(m StoryMatch, extraDomains ...string) (storyMatcher, error) {
+	sm := storyMatcher{titlePrefix: strings.ToLower(m.TitlePrefix)}
+	for _, t := range m.Types {
+		sm.types = append(sm.types, strings.ToLower(t))
+	}
+	for _, d := range slices.Concat(m.Domains, extraDomains) {
+		sm.domains = append(sm.domains, strings.TrimPrefix(strings.ToLower(d), "www."))
+	}
+	if m.Keyword != "" {
+		re, err := regexp.Compile(m.Keyword)
+		if err != nil {
+			return storyMatcher{}, fmt.Errorf("keyword: %w", err)
+		}
+		sm.keyword = re
+	}
+	return sm, nil
+}
+
+// matches reports whether every condition set holds for story. A matcher
+// with no conditions matches everything.
+func (m *storyMatcher) matches(story Story) bool {
+	if len(m.types) > 0 && !slices.Contains(m.types, story.Type) {
+		return false
+	}
+
+	if m.titlePrefix != "" && !strings.HasPrefix(strings.ToLower(strings.TrimSpace(story.Title)), m.titlePrefix) {
+		return false
+	}
+
+	if len(m.domains) > 0 {
+		u, err := url.Parse(story.URL)
+		if err != nil {
+			return false
+		}
+		host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		if !slices.ContainsFunc(parentDomains(host), func(h string) bool { return slices.Contains(m.domains, h) }) {
+			return false
+		}
+	}
+
+	if m.keyword != nil && !m.keyword.MatchString(story.Title) {
+		return false
+	}
+
+	return true
+}
+
+// route is a compiled RouteConfig.
+type route struct {
+	storyMatcher
+	subreddits []string
+}
+
+// Router picks the subreddits each story is posted to. Every matching
+// route contributes its subreddits; a story no route matches goes to the
+// default. A nil Router always uses the default.
+type Router struct {
+	routes []route
+}
+
+// newRouter compiles cfg.Routes, returning nil when there are none.
+func newRouter(cfg *Config) (*Router, error) {
+	if len(cfg.Routes) == 0 {
+		return nil, nil
+	}
+
+	r := &Router{}
+	for i, rc := range cfg.Routes {
+		m, err := newStoryMatcher(rc.StoryMatch)
+		if err != nil {
+			return nil, fmt.Errorf("routes[%d].%w", i, err)
+		}
+		r.routes = append(r.routes, route{storyMatcher: m, subreddits: rc.Subreddits})
+	}
+	return r, nil
+}
+
+// Targets returns the subreddits story should be posted to, without
+// repeats, or just fallback if no route matches.
+func (r *Router) Targets(story Story, fallback []string) []string {
+	if r == nil {
+		return fallback
+	}
+
+	var targets []string
+	for i := range r.routes {
+		if !r.routes[i].matches(story) {
+			continue
+		}
+		for _, sub := range r.routes[i].subreddits {
+			targets = appendSubreddit(targets, sub)
+		}
+	}
+
+	if len(targets) == 0 {
+		return fallback
+	}
+	return targets
+}
+
+// appendSubreddit adds sub to subs unless it is already there, in any case.
+func appendSubreddit(subs []string, sub string) []string {
+	if slices.ContainsFunc(subs, func(s string) bool { return strings.EqualFold(s, sub) }) {
+		return subs
+	}
+	return append(subs, sub)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/turnage/graw/reddit"
+)
+
+func TestRouterTargets(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Routes = []RouteConfig{
+		{StoryMatch: StoryMatch{Types: []string{"show"}}, Subreddits: []string{"ShowHN"}},
+		{StoryMatch: StoryMatch{TitlePrefix: "Launch HN:"}, Subreddits: []string{"startups", "ShowHN"}},
+		{StoryMatch: StoryMatch{Domains: []string{"github.com"}}, Subreddits: []string{"opensource"}},
+		{StoryMatch: StoryMatch{Keyword: `(?i)\brust\b`, Types: []string{"story", "show"}}, Subreddits: []string{"rust"}},
+	}
+
+	router, err := newRouter(cfg)
+	if err != nil {
+		t.Fatalf("newRouter: %v", err)
+	}
+
+	testCases := []struct {
+		name  string
+		story Story
+		want  []string
+	}{
+		{
+			name:  "No route matches",
+			story: Story{Title: "A plain story", URL: "https://example.com/", Type: STORY_TYPE_STORY},
+			want:  []string{"hackernews"},
+		},
+		{
+			name:  "Type",
+			story: Story{Title: "Show HN: Gizmo", URL: "https://gizmo.dev/", Type: STORY_TYPE_SHOW},
+			want:  []string{"ShowHN"},
+		},
+		{
+			name:  "Title prefix with repeated target",
+			story: Story{Title: "Launch HN: Acme (YC W24)", URL: "https://acme.com/", Type: STORY_TYPE_LAUNCH},
+			want:  []string{"startups", "ShowHN"},
+		},
+		{
+			name:  "Subdomain and keyword",
+			story: Story{Title: "Show HN: A Rust linter", URL: "https://gist.github.com/x/y", Type: STORY_TYPE_SHOW},
+			want:  []string{"ShowHN", "opensource", "rust"},
+		},
+		{
+			name:  "Keyword needs matching type",
+			story: Story{Title: "Ask HN: Is Rust worth it?", URL: "https://news.ycombinator.com/item?id=1", Type: STORY_TYPE_ASK},
+			want:  []string{"hackernews"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := router.Targets(tc.story, []string{"hackernews"}); !slices.Equal(got, tc.want) {
+				t.Errorf("Targets = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	var none *Router
+	if got := none.Targets(Story{}, []string{"hackernews"}); !slices.Equal(got, []string{"hackernews"}) {
+		t.Errorf("nil Router Targets = %v", got)
+	}
+}
+
+func TestTargetsFor(t *testing.T) {
+	app := &App{cfg: defaultConfig()}
+
+	testCases := []struct {
+		name       string
+		subreddits []string
+		want       []string
+	}{
+		{"No feed subreddit", nil, []string{"hackernews"}},
+		{"Feed without a subreddit", []string{""}, []string{"hackernews"}},
+		{"In two feeds", []string{"", "golang_hn"}, []string{"hackernews", "golang_hn"}},
+		{"Same subreddit twice", []string{"GoLang_HN", "golang_hn"}, []string{"GoLang_HN"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := app.targetsFor(Story{Subreddits: tc.subreddits}); !slices.Equal(got, tc.want) {
+				t.Errorf("targetsFor = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// listingBot counts the listings fetched.
+type listingBot struct {
+	fakeBot
+	listings int
+}
+
+func (b *listingBot) ListingWithParams(path string, params map[string]string) (reddit.Harvest, error) {
+	b.listings++
+	return b.fakeBot.ListingWithParams(path, params)
+}
+
+func TestProcessFeedFetchesListingsOnce(t *testing.T) {
+	app := newTestApp(t, nil)
+	bot := &listingBot{}
+	app.bot = bot
+	app.plan = &Plan{}
+	if err := app.store.BanDomain("hackernews", "banned.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	stories := []Story{
+		{ID: 1, Title: "Banned story", URL: "https://banned.example.com/a", Time: now},
+		{ID: 2, Title: "Another story", URL: "https://example.com/b", Time: now},
+		{ID: 3, Title: "A third story", URL: "https://example.com/c", Time: now},
+	}
+	if err := app.processFeed(context.Background(), stories); err != nil {
+		t.Fatalf("processFeed: %v", err)
+	}
+
+	// new, hot and top, once for the subreddit.
+	if bot.listings != 3 {
+		t.Errorf("fetched %d listings, want 3", bot.listings)
+	}
+}
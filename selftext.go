@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// REDDIT_SELFTEXT_LIMIT is the most characters Reddit accepts in a self
+// post body.
+const REDDIT_SELFTEXT_LIMIT = 40000
+
+var (
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`",
+		"[", `\[`, "]", `\]`, "^", `\^`, "~", `\~`,
+	)
+	extraNewlines = regexp.MustCompile(`\n{3,}`)
+	hnThreadLink  = regexp.MustCompile(`\(https://news\.ycombinator\.com/item\?id=(\d+)\)\s*$`)
+)
+
+// hnHTMLToMarkdown converts the HTML subset HN uses for story text (<p>
+// separators, <a>, <i>, <pre><code>) into Reddit markdown.
+func hnHTMLToMarkdown(s string) string {
+	var b strings.Builder
+
+	var inPre bool
+	var href string
+	var linkText strings.Builder
+	inLink := false
+
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		tok := z.Token()
+		switch tt {
+		case html.TextToken:
+			switch {
+			case inPre:
+				b.WriteString(indentCode(tok.Data))
+			case inLink:
+				linkText.WriteString(tok.Data)
+			default:
+				b.WriteString(markdownEscaper.Replace(tok.Data))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch tok.Data {
+			case "p":
+				if b.Len() > 0 {
+					b.WriteString("\n\n")
+				}
+			case "br":
+				b.WriteString("  \n")
+			case "i", "em":
+				if !inPre {
+					b.WriteString("*")
+				}
+			case "pre":
+				inPre = true
+				b.WriteString("\n\n")
+			case "a":
+				inLink = true
+				href = ""
+				linkText.Reset()
+				for _, attr := range tok.Attr {
+					if attr.Key == "href" {
+						href = attr.Val
+					}
+				}
+			}
+
+		case html.EndTagToken:
+			switch tok.Data {
+			case "i", "em":
+				if !inPre {
+					b.WriteString("*")
+				}
+			case "pre":
+				inPre = false
+				b.WriteString("\n\n")
+			case "a":
+				inLink = false
+				b.WriteString(markdownLink(linkText.String(), href))
+			}
+		}
+	}
+
+	out := extraNewlines.ReplaceAllString(b.String(), "\n\n")
+	return strings.TrimSpace(out)
+}
+
+// markdownLink renders an HN link. HN shortens long link text with "...",
+// so when the text is just the URL the bare URL is used and Reddit links it.
+func markdownLink(text, href string) string {
+	if href == "" {
+		return markdownEscaper.Replace(text)
+	}
+	if text == "" || text == href || strings.HasPrefix(href, strings.TrimSuffix(text, "...")) {
+		return href
+	}
+	href = strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(href)
+	return fmt.Sprintf("[%s](%s)", markdownEscaper.Replace(text), href)
+}
+
+// indentCode turns pre-formatted text into an indented markdown code block.
+func indentCode(s string) string {
+	lines := strings.Split(strings.Trim(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "    " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// selfPostBody is the Reddit body for an HN text story: the converted text
+// and a footer linking the HN thread, cut to fit REDDIT_SELFTEXT_LIMIT.
+func selfPostBody(story Story) string {
+	footer := "[Discussion on HN](" + story.HNURL() + ")"
+	if story.Author != "" {
+		footer = fmt.Sprintf("Posted by %s. %s", markdownEscaper.Replace(story.Author), footer)
+	}
+	footer = "\n\n---\n\n" + footer
+
+	text := hnHTMLToMarkdown(story.Text)
+	if text == "" {
+		return strings.TrimPrefix(footer, "\n\n---\n\n")
+	}
+
+	const truncated = "\n\n*(truncated, read the rest on HN)*"
+	if utf8.RuneCountInString(text)+utf8.RuneCountInString(footer) > REDDIT_SELFTEXT_LIMIT {
+		text = truncateMarkdown(text, REDDIT_SELFTEXT_LIMIT-utf8.RuneCountInString(footer)-utf8.RuneCountInString(truncated)) + truncated
+	}
+
+	return text + footer
+}
+
+// selfPostHNID finds the HN story a self post was made from, by the
+// thread link selfPostBody puts at the end.
+func selfPostHNID(selfText string) int {
+	m := hnThreadLink.FindStringSubmatch(selfText)
+	if m == nil {
+		return 0
+	}
+	id, _ := strconv.Atoi(m[1])
+	return id
+}
+
+// truncateMarkdown cuts s to at most limit runes, preferring a paragraph
+// break and otherwise a space, so links and escapes aren't split.
+func truncateMarkdown(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+
+	runes := []rune(s)
+	cut := string(runes[:limit])
+
+	if i := strings.LastIndex(cut, "\n\n"); i > len(cut)/2 {
+		return strings.TrimSpace(cut[:i])
+	}
+	if i := strings.LastIndexAny(cut, " \n"); i > 0 {
+		cut = cut[:i]
+	}
+
+	// Don't leave half a link behind.
+	if open := strings.LastIndex(cut, "["); open > strings.LastIndex(cut, ")") {
+		cut = cut[:open]
+	}
+
+	return strings.TrimSpace(cut)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHNHTMLToMarkdown(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "Paragraphs and entities",
+			in:   "First line &amp; more.<p>Second &quot;para&quot; isn&#x27;t last.<p>Third",
+			want: "First line & more.\n\nSecond \"para\" isn't last.\n\nThird",
+		},
+		{
+			name: "Italics and escaping",
+			in:   "This is <i>really</i> 2*3 and snake_case",
+			want: "This is *really* 2\\*3 and snake\\_case",
+		},
+		{
+			name: "Named link",
+			in:   `See <a href="https://example.com/a_(b)" rel="nofollow">the docs</a>.`,
+			want: "See [the docs](https://example.com/a_%28b%29).",
+		},
+		{
+			name: "Shortened URL link",
+			in:   `<a href="https://example.com/a/very/long/path/to/something" rel="nofollow">https://example.com/a/very/long/path/...</a>`,
+			want: "https://example.com/a/very/long/path/to/something",
+		},
+		{
+			name: "Code block",
+			in:   "Try this:<p><pre><code>  func main() {\n    fmt.Println(&quot;*hi*&quot;)\n  }\n</code></pre>\nThanks",
+			want: "Try this:\n\n      func main() {\n        fmt.Println(\"*hi*\")\n      }\n\nThanks",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := hnHTMLToMarkdown(tc.in); got != tc.want {
+				t.Errorf("hnHTMLToMarkdown(%q)\n got: %q\nwant: %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSelfPostBody(t *testing.T) {
+	story := Story{ID: 77, Title: "Ask HN: Thoughts?", URL: hnItemURL(77), Author: "dang", Text: "Short question."}
+
+	body := selfPostBody(story)
+	want := "Short question.\n\n---\n\nPosted by dang. [Discussion on HN](https://news.ycombinator.com/item?id=77)"
+	if body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+	if selfPostHNID(body) != 77 {
+		t.Errorf("selfPostHNID = %d, want 77", selfPostHNID(body))
+	}
+
+	story.Text = strings.Repeat("<p>"+strings.Repeat("word ", 199)+"é", 50)
+	body = selfPostBody(story)
+	if n := utf8.RuneCountInString(body); n > REDDIT_SELFTEXT_LIMIT {
+		t.Errorf("body is %d characters, over the %d limit", n, REDDIT_SELFTEXT_LIMIT)
+	}
+	if !strings.Contains(body, "truncated") || !strings.HasSuffix(body, "(https://news.ycombinator.com/item?id=77)") {
+		t.Errorf("truncated body should keep the marker and footer, ends with %q", body[len(body)-120:])
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	STORY_TYPE_STORY  = "story"
+	STORY_TYPE_ASK    = "ask"
+	STORY_TYPE_SHOW   = "show"
+	STORY_TYPE_TELL   = "tell"
+	STORY_TYPE_LAUNCH = "launch"
+	STORY_TYPE_JOB    = "job"
+	STORY_TYPE_POLL   = "poll"
+)
+
+// Story is an HN story as reported by any Source. URL is the article link,
+// or the HN item itself for text posts, whose body is in Text as HN HTML.
+// Subreddits are the subreddits of the feeds it came from, "" standing for
+// reddit.subreddit; it is empty for sources without per-feed subreddits.
+type Story struct {
+	ID         int
+	Title      string
+	URL        string
+	Text       string
+	Points     int
+	Comments   int
+	Author     string
+	Time       time.Time
+	Type       string
+	Subreddits []string
+}
+
+// HNURL is the story's discussion page on HN.
+func (s Story) HNURL() string {
+	if s.ID == 0 {
+		return ""
+	}
+	return hnItemURL(s.ID)
+}
+
+// IsText reports whether story is an HN text post (Ask HN, Tell HN...)
+// rather than a link to an article.
+func (s Story) IsText() bool {
+	return hnItemID(s.URL) != 0
+}
+
+// storyTypeFromTitle infers the type from HN's title prefixes, for sources
+// that don't report one.
+func storyTypeFromTitle(title string) string {
+	lower := strings.ToLower(strings.TrimSpace(title))
+	for prefix, typ := range map[string]string{
+		"ask hn":    STORY_TYPE_ASK,
+		"show hn":   STORY_TYPE_SHOW,
+		"tell hn":   STORY_TYPE_TELL,
+		"launch hn": STORY_TYPE_LAUNCH,
+	} {
+		if strings.HasPrefix(lower, prefix) {
+			return typ
+		}
+	}
+	return STORY_TYPE_STORY
+}
+
+// Source yields the stories that currently qualify for posting.
+type Source interface {
+	Name() string
+	Stories(ctx context.Context) ([]Story, error)
+}
+
+// fallbackSource tries each source in order and returns the first that
+// succeeds.
+type fallbackSource []Source
+
+func (f fallbackSource) Name() string {
+	names := make([]string, len(f))
+	for i, s := range f {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (f fallbackSource) Stories(ctx context.Context) ([]Story, error) {
+	var errs []error
+	for _, s := range f {
+		stories, err := s.Stories(ctx)
+		if err == nil {
+			return stories, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		logger.Printf("Warning: source %s failed: %v\n", s.Name(), err)
+		errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// newSource builds the configured sources in fallback order.
+func newSource(cfg *Config, client *http.Client) (Source, error) {
+	var sources fallbackSource
+	for _, name := range cfg.Feed.Sources {
+		switch name {
+		case SOURCE_HNRSS:
+			sources = append(sources, &hnrssSource{cfg: cfg})
+		case SOURCE_FIREBASE:
+			sources = append(sources, &firebaseSource{cfg: cfg, client: client})
+		case SOURCE_ALGOLIA:
+			sources = append(sources, &algoliaSource{cfg: cfg, client: client})
+		default:
+			return nil, fmt.Errorf("unknown feed source %q", name)
+		}
+
+		if name != SOURCE_HNRSS && len(cfg.Feed.Feeds) > 0 {
+			logger.Printf("Warning: the %s source ignores [[feed.feeds]]: it uses the [feed] thresholds, no max_age and reddit.subreddit\n", name)
+		}
+	}
+
+	if len(sources) == 0 {
+		return nil, errors.New("no feed sources configured")
+	}
+	if len(sources) == 1 {
+		return sources[0], nil
+	}
+	return sources, nil
+}
+
+// mergeStories drops repeats of the same HN item, which happen when it is
+// in several feeds. The first occurrence wins, so earlier feeds take
+// priority, but it is posted to the subreddits of every feed it was in.
+func mergeStories(stories []Story) []Story {
+	seen := make(map[string]int, len(stories))
+	merged := make([]Story, 0, len(stories))
+	for _, s := range stories {
+		key := storeKey(s)
+		if i, ok := seen[key]; ok {
+			for _, sub := range s.Subreddits {
+				merged[i].Subreddits = appendSubreddit(merged[i].Subreddits, sub)
+			}
+			continue
+		}
+		seen[key] = len(merged)
+		s.Subreddits = slices.Clone(s.Subreddits)
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// meetsThresholds applies the points and comments thresholds locally, for
+// sources that can't filter server-side.
+func meetsThresholds(cfg *Config, s Story) bool {
+	return s.Points >= cfg.Feed.PointsThreshold && s.Comments >= cfg.Feed.CommentsThreshold
+}
+
+// getStoriesWithRetry fetches stories, retrying the whole fallback chain
+// with exponential backoff.
+func getStoriesWithRetry(ctx context.Context, source Source) ([]Story, error) {
+	var stories []Story
+	var err error
+	maxRetries := 5
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		stories, err = source.Stories(ctx)
+		if err == nil {
+			return stories, nil
+		}
+		if attempt == maxRetries-1 {
+			break
+		}
+		backoff := time.Duration(1<<uint(attempt)) * time.Second // 1s, 2s, 4s, 8s, 16s
+		logger.Printf("Feed fetch failed (attempt %d/%d): %v. Retrying in %v...\n", attempt+1, maxRetries, err, backoff)
+		if !sleepContext(ctx, backoff) {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("failed to get feed after %d attempts: %w", maxRetries, err)
+}
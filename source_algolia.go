@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const SOURCE_ALGOLIA = "algolia"
+
+// algoliaHit is a story from the Algolia HN Search API.
+type algoliaHit struct {
+	ObjectID    string   `json:"objectID"`
+	Title       string   `json:"title"`
+	URL         string   `json:"url"`
+	Author      string   `json:"author"`
+	Points      int      `json:"points"`
+	NumComments int      `json:"num_comments"`
+	CreatedAtI  int64    `json:"created_at_i"`
+	StoryText   string   `json:"story_text"`
+	Tags        []string `json:"_tags"`
+}
+
+type algoliaResponse struct {
+	Hits []algoliaHit `json:"hits"`
+}
+
+// algoliaSource reads the current front page from hn.algolia.com, with the
+// thresholds applied as numeric filters.
+type algoliaSource struct {
+	cfg    *Config
+	client *http.Client
+}
+
+func (s *algoliaSource) Name() string {
+	return SOURCE_ALGOLIA
+}
+
+func (s *algoliaSource) Stories(ctx context.Context) ([]Story, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Feed.Timeout)
+	defer cancel()
+
+	query := url.Values{}
+	query.Set("tags", "front_page")
+	query.Set("hitsPerPage", strconv.Itoa(s.cfg.Feed.Count))
+	query.Set("numericFilters", fmt.Sprintf("points>=%d,num_comments>=%d", s.cfg.Feed.PointsThreshold, s.cfg.Feed.CommentsThreshold))
+
+	searchURL := strings.TrimSuffix(s.cfg.Feed.AlgoliaURL, "/") + "/search?" + query.Encode()
+
+	var resp algoliaResponse
+	if err := getJSON(ctx, s.client, s.cfg.Reddit.Agent, searchURL, &resp); err != nil {
+		return nil, err
+	}
+
+	stories := make([]Story, 0, len(resp.Hits))
+	for _, hit := range resp.Hits {
+		story, ok := storyFromAlgoliaHit(hit)
+		if !ok || !meetsThresholds(s.cfg, story) {
+			continue
+		}
+		stories = append(stories, story)
+	}
+
+	return stories, nil
+}
+
+func storyFromAlgoliaHit(hit algoliaHit) (Story, bool) {
+	id, err := strconv.Atoi(hit.ObjectID)
+	if err != nil || id <= 0 || hit.Title == "" {
+		return Story{}, false
+	}
+
+	story := Story{
+		ID:       id,
+		Title:    hit.Title,
+		URL:      hit.URL,
+		Text:     hit.StoryText,
+		Points:   hit.Points,
+		Comments: hit.NumComments,
+		Author:   hit.Author,
+		Time:     time.Unix(hit.CreatedAtI, 0),
+		Type:     storyTypeFromTitle(hit.Title),
+	}
+
+	switch {
+	case slices.Contains(hit.Tags, "ask_hn"):
+		story.Type = STORY_TYPE_ASK
+	case slices.Contains(hit.Tags, "show_hn"):
+		story.Type = STORY_TYPE_SHOW
+	case slices.Contains(hit.Tags, "launch_hn"):
+		story.Type = STORY_TYPE_LAUNCH
+	case slices.Contains(hit.Tags, "job"):
+		story.Type = STORY_TYPE_JOB
+	case slices.Contains(hit.Tags, "poll"):
+		story.Type = STORY_TYPE_POLL
+	}
+
+	if story.URL == "" {
+		story.URL = hnItemURL(id)
+	}
+
+	return story, true
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SOURCE_FIREBASE = "firebase"
+
+// firebaseItem is an item from the official HN API.
+type firebaseItem struct {
+	ID          int    `json:"id"`
+	Type        string `json:"type"`
+	By          string `json:"by"`
+	Time        int64  `json:"time"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Text        string `json:"text"`
+	Score       int    `json:"score"`
+	Descendants int    `json:"descendants"`
+	Dead        bool   `json:"dead"`
+	Deleted     bool   `json:"deleted"`
+}
+
+const (
+	FIREBASE_TOP_STORIES  = "topstories"
+	FIREBASE_BEST_STORIES = "beststories"
+)
+
+// firebaseSource reads the official HN API at hacker-news.firebaseio.com
+// and applies the thresholds locally. Items are fetched concurrently by a
+// bounded pool of workers.
+type firebaseSource struct {
+	cfg    *Config
+	client *http.Client
+}
+
+func (s *firebaseSource) Name() string {
+	return SOURCE_FIREBASE
+}
+
+func (s *firebaseSource) Stories(ctx context.Context) ([]Story, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Feed.Timeout)
+	defer cancel()
+
+	list := s.cfg.Feed.FirebaseList
+	var ids []int
+	if err := s.get(ctx, "/"+list+".json", &ids); err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", list, err)
+	}
+
+	if len(ids) > s.cfg.Feed.Count {
+		ids = ids[:s.cfg.Feed.Count]
+	}
+
+	items, err := s.fetchItems(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var stories []Story
+	for _, item := range items {
+		story, ok := storyFromFirebaseItem(item)
+		if !ok || !meetsThresholds(s.cfg, story) {
+			continue
+		}
+		stories = append(stories, story)
+	}
+
+	return stories, nil
+}
+
+// fetchItems gets every id with at most cfg.Feed.Workers requests in
+// flight, keeping the ranking order. Items that fail are skipped; it only
+// errors if none could be fetched.
+func (s *firebaseSource) fetchItems(ctx context.Context, ids []int) ([]firebaseItem, error) {
+	items := make([]firebaseItem, len(ids))
+	errs := make([]error, len(ids))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, min(s.cfg.Feed.Workers, len(ids))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = s.get(ctx, fmt.Sprintf("/item/%d.json", ids[i]), &items[i])
+			}
+		}()
+	}
+
+	for i := range ids {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var fetched []firebaseItem
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			logger.Printf("Warning: failed to get HN item %d: %v\n", ids[i], err)
+			failed = append(failed, err)
+			continue
+		}
+		fetched = append(fetched, items[i])
+	}
+
+	if len(ids) > 0 && len(fetched) == 0 {
+		return nil, fmt.Errorf("failed to get any of %d items: %w", len(ids), errors.Join(failed...))
+	}
+
+	return fetched, nil
+}
+
+func (s *firebaseSource) get(ctx context.Context, path string, v any) error {
+	return getJSON(ctx, s.client, s.cfg.Reddit.Agent, strings.TrimSuffix(s.cfg.Feed.FirebaseURL, "/")+path, v)
+}
+
+func storyFromFirebaseItem(item firebaseItem) (Story, bool) {
+	if item.ID == 0 || item.Dead || item.Deleted || item.Title == "" {
+		return Story{}, false
+	}
+
+	story := Story{
+		ID:       item.ID,
+		Title:    item.Title,
+		URL:      item.URL,
+		Text:     item.Text,
+		Points:   item.Score,
+		Comments: item.Descendants,
+		Author:   item.By,
+		Time:     time.Unix(item.Time, 0),
+		Type:     storyTypeFromTitle(item.Title),
+	}
+
+	switch item.Type {
+	case "job":
+		story.Type = STORY_TYPE_JOB
+	case "poll":
+		story.Type = STORY_TYPE_POLL
+	case "story":
+	default:
+		return Story{}, false
+	}
+
+	if story.URL == "" {
+		story.URL = hnItemURL(item.ID)
+	}
+
+	return story, true
+}
+
+// getJSON fetches url and decodes the JSON response into v.
+func getJSON(ctx context.Context, client *http.Client, agent, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", agent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const SOURCE_HNRSS = "hnrss"
+
+var (
+	hnrssPointsRegex   = regexp.MustCompile(`Points:\s*(\d+)`)
+	hnrssCommentsRegex = regexp.MustCompile(`# Comments:\s*(\d+)`)
+)
+
+// hnrssSource reads every configured hnrss.org feed, which apply the
+// points and comments thresholds server-side. Stories are returned in
+// feed order; repeats across feeds are left for mergeStories.
+type hnrssSource struct {
+	cfg *Config
+}
+
+func (s *hnrssSource) Name() string {
+	return SOURCE_HNRSS
+}
+
+func (s *hnrssSource) Stories(ctx context.Context) ([]Story, error) {
+	var stories []Story
+	var errs []error
+
+	feeds := s.cfg.hnrssFeeds()
+	for _, feedCfg := range feeds {
+		feed, err := getFeed(ctx, s.cfg, feedCfg)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			logger.Printf("Warning: hnrss feed %s failed: %v\n", feedCfg.Name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", feedCfg.Name, err))
+			continue
+		}
+
+		var cutoff time.Time
+		if feedCfg.MaxAge > 0 {
+			cutoff = time.Now().Add(-feedCfg.MaxAge)
+		}
+
+		for _, item := range feed.Items {
+			if item == nil {
+				continue
+			}
+			story := storyFromFeedItem(item)
+			if !cutoff.IsZero() && story.Time.Before(cutoff) {
+				continue
+			}
+			story.Subreddits = []string{feedCfg.Subreddit}
+			stories = append(stories, story)
+		}
+	}
+
+	if len(errs) == len(feeds) {
+		return nil, errors.Join(errs...)
+	}
+
+	return stories, nil
+}
+
+// storyFromFeedItem converts an hnrss item. Points, comment counts and
+// the text of text posts are scraped from the description hnrss generates.
+func storyFromFeedItem(item *gofeed.Item) Story {
+	story := Story{
+		ID:    hnItemID(item.GUID),
+		Title: item.Title,
+		URL:   item.Link,
+		Type:  storyTypeFromTitle(item.Title),
+	}
+
+	if item.PublishedParsed != nil {
+		story.Time = *item.PublishedParsed
+	}
+
+	if item.Author != nil {
+		story.Author = item.Author.Name
+	}
+
+	// Text posts carry the story text ahead of hnrss's own <hr> footer.
+	if story.IsText() {
+		if text, _, ok := strings.Cut(item.Description, "<hr>"); ok {
+			story.Text = strings.TrimSpace(text)
+		}
+	}
+
+	if m := hnrssPointsRegex.FindStringSubmatch(item.Description); len(m) > 1 {
+		story.Points, _ = strconv.Atoi(m[1])
+	}
+	if m := hnrssCommentsRegex.FindStringSubmatch(item.Description); len(m) > 1 {
+		story.Comments, _ = strconv.Atoi(m[1])
+	}
+
+	return story
+}
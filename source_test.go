@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+type stubSource struct {
+	name    string
+	stories []Story
+	err     error
+	calls   int
+}
+
+func (s *stubSource) Name() string { return s.name }
+
+func (s *stubSource) Stories(ctx context.Context) ([]Story, error) {
+	s.calls++
+	return s.stories, s.err
+}
+
+func TestFallbackSource(t *testing.T) {
+	broken := &stubSource{name: "broken", err: errors.New("down")}
+	working := &stubSource{name: "working", stories: []Story{{ID: 1, Title: "One"}}}
+	unused := &stubSource{name: "unused", stories: []Story{{ID: 2}}}
+
+	stories, err := fallbackSource{broken, working, unused}.Stories(context.Background())
+	if err != nil {
+		t.Fatalf("Stories: %v", err)
+	}
+	if len(stories) != 1 || stories[0].ID != 1 {
+		t.Errorf("got %+v, want the working source's stories", stories)
+	}
+	if unused.calls != 0 {
+		t.Error("sources after the first success should not be called")
+	}
+
+	_, err = fallbackSource{broken, &stubSource{name: "also-broken", err: errors.New("gone")}}.Stories(context.Background())
+	if err == nil {
+		t.Fatal("expected an error when every source fails")
+	}
+}
+
+func TestStoryFromFeedItem(t *testing.T) {
+	item := &gofeed.Item{
+		Title:       "Ask HN: Anyone else?",
+		Link:        "https://news.ycombinator.com/item?id=555",
+		GUID:        "https://news.ycombinator.com/item?id=555",
+		Description: "<p>Is it <i>just</i> me?</p>\n<hr><p>Comments URL: <a href=\"https://news.ycombinator.com/item?id=555\">x</a></p>\n<p>Points: 123</p>\n<p># Comments: 45</p>",
+		Author:      &gofeed.Person{Name: "pg"},
+	}
+
+	story := storyFromFeedItem(item)
+	want := Story{ID: 555, Title: item.Title, URL: item.Link, Text: "<p>Is it <i>just</i> me?</p>", Points: 123, Comments: 45, Author: "pg", Type: STORY_TYPE_ASK}
+	if !reflect.DeepEqual(story, want) {
+		t.Errorf("got %+v, want %+v", story, want)
+	}
+}
+
+func TestFirebaseSource(t *testing.T) {
+	items := map[int]string{
+		1: `{"id":1,"type":"story","title":"Popular","url":"https://example.com/1","score":300,"descendants":50,"by":"a","time":1700000000}`,
+		2: `{"id":2,"type":"story","title":"Too quiet","url":"https://example.com/2","score":5,"descendants":0,"time":1700000000}`,
+		3: `{"id":3,"type":"story","title":"Killed","url":"https://example.com/3","score":500,"descendants":80,"dead":true,"time":1700000000}`,
+		4: `{"id":4,"type":"story","title":"Ask HN: A question","score":200,"descendants":90,"time":1700000000}`,
+		6: `{"id":6,"deleted":true,"time":1700000000}`,
+		7: `{"id":7,"type":"comment","text":"hi","time":1700000000}`,
+	}
+
+	var inFlight, peak atomic.Int32
+	var list string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/topstories.json", "/beststories.json":
+			list = r.URL.Path
+			fmt.Fprint(w, "[1,2,3,4,5,6,7,8]")
+			return
+		}
+
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		var id int
+		if _, err := fmt.Sscanf(r.URL.Path, "/item/%d.json", &id); err != nil || items[id] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, items[id])
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Feed.FirebaseURL = srv.URL
+	cfg.Feed.FirebaseList = FIREBASE_BEST_STORIES
+	cfg.Feed.Count = 7
+	cfg.Feed.Workers = 3
+
+	stories, err := (&firebaseSource{cfg: cfg, client: srv.Client()}).Stories(context.Background())
+	if err != nil {
+		t.Fatalf("Stories: %v", err)
+	}
+
+	if list != "/beststories.json" {
+		t.Errorf("read %s, want /beststories.json", list)
+	}
+	if p := peak.Load(); p > 3 {
+		t.Errorf("%d item requests in flight, want at most 3", p)
+	}
+	if len(stories) != 2 {
+		t.Fatalf("got %d stories, want 2: %+v", len(stories), stories)
+	}
+	if stories[0].ID != 1 || stories[0].Points != 300 || stories[0].Comments != 50 || stories[0].Author != "a" {
+		t.Errorf("unexpected first story: %+v", stories[0])
+	}
+	if stories[1].URL != hnItemURL(4) || stories[1].Type != STORY_TYPE_ASK {
+		t.Errorf("text post should link to HN: %+v", stories[1])
+	}
+}
+
+func TestFirebaseSourceAllItemsFail(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/topstories.json" {
+			fmt.Fprint(w, "[1,2]")
+			return
+		}
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Feed.FirebaseURL = srv.URL
+
+	if _, err := (&firebaseSource{cfg: cfg, client: srv.Client()}).Stories(context.Background()); err == nil {
+		t.Error("expected an error when no items can be fetched")
+	}
+}
+
+func TestAlgoliaSource(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"hits":[
+			{"objectID":"10","title":"Show HN: Thing","url":"https://thing.dev","points":150,"num_comments":20,"author":"b","created_at_i":1700000000,"_tags":["story","show_hn"]},
+			{"objectID":"11","title":"Tell HN: News","points":120,"num_comments":30,"created_at_i":1700000000,"_tags":["story"]},
+			{"objectID":"bogus","title":"Broken"}
+		]}`)
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Feed.AlgoliaURL = srv.URL
+
+	stories, err := (&algoliaSource{cfg: cfg, client: srv.Client()}).Stories(context.Background())
+	if err != nil {
+		t.Fatalf("Stories: %v", err)
+	}
+
+	if query == "" {
+		t.Fatal("no search request made")
+	}
+	if len(stories) != 2 {
+		t.Fatalf("got %d stories, want 2: %+v", len(stories), stories)
+	}
+	if stories[0].ID != 10 || stories[0].Type != STORY_TYPE_SHOW || stories[0].Comments != 20 {
+		t.Errorf("unexpected first story: %+v", stories[0])
+	}
+	if stories[1].URL != hnItemURL(11) || stories[1].Type != STORY_TYPE_TELL {
+		t.Errorf("unexpected second story: %+v", stories[1])
+	}
+}
+
+func TestHnrssSourceMergesFeeds(t *testing.T) {
+	fresh := time.Now().Add(-time.Hour).Format(time.RFC1123Z)
+	stale := time.Now().Add(-72 * time.Hour).Format(time.RFC1123Z)
+	feedItem := func(id int, title, pubDate string) string {
+		return fmt.Sprintf(`<item><title>%s</title><link>https://example.com/%d</link><guid>https://news.ycombinator.com/item?id=%d</guid><pubDate>%s</pubDate></item>`, title, id, id, pubDate)
+	}
+	feeds := map[string]string{
+		"/frontpage": feedItem(1, "Front", fresh) + feedItem(2, "Show HN: Both", fresh),
+		"/show":      feedItem(2, "Show HN: Both", fresh) + feedItem(3, "Show HN: New", fresh) + feedItem(4, "Show HN: Old", stale),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		items, ok := feeds[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>HN</title>%s</channel></rss>`, items)
+	}))
+	defer srv.Close()
+
+	cfg := defaultConfig()
+	cfg.Feed.Protocol = "http"
+	cfg.Feed.BaseURL = strings.TrimPrefix(srv.URL, "http://")
+	cfg.Feed.Feeds = []HnrssFeed{
+		{Name: "frontpage"},
+		{Name: "show", MaxAge: 24 * time.Hour, Subreddit: "showhn"},
+		{Name: "missing"},
+	}
+
+	stories, err := (&hnrssSource{cfg: cfg}).Stories(context.Background())
+	if err != nil {
+		t.Fatalf("Stories: %v", err)
+	}
+
+	merged := mergeStories(stories)
+	var got []string
+	for _, s := range merged {
+		got = append(got, fmt.Sprintf("%d:%q", s.ID, s.Subreddits))
+	}
+	if want := `1:[""] 2:["" "showhn"] 3:["showhn"]`; strings.Join(got, " ") != want {
+		t.Errorf("merged stories = %q, want %q", strings.Join(got, " "), want)
+	}
+}
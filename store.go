@@ -0,0 +1,726 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const STORE_VERSION = 1
+
+// StoredItem is everything the bot remembers about a single story.
+// Items are keyed by their HN item URL; RedditName and PostedAt record the
+// first submission and Posts every submission, one per subreddit.
+type StoredItem struct {
+	GUID          string       `json:"guid"`
+	HNID          int          `json:"hn_id,omitempty"`
+	URL           string       `json:"url"`
+	NormalizedURL string       `json:"normalized_url"`
+	Title         string       `json:"title"`
+	RedditName    string       `json:"reddit_name,omitempty"`
+	FirstSeen     time.Time    `json:"first_seen"`
+	LastSeen      time.Time    `json:"last_seen"`
+	PostedAt      time.Time    `json:"posted_at,omitempty"`
+	Posts         []StoredPost `json:"posts,omitempty"`
+}
+
+// StoredPost is one submission of an item to a subreddit, and the bot's
+// "Discussion on HN" comment on it. CommentText is what the comment last
+// said; CommentDone is set once it is no longer kept up to date.
+type StoredPost struct {
+	Subreddit   string    `json:"subreddit"`
+	Name        string    `json:"name"`
+	PostedAt    time.Time `json:"posted_at"`
+	Comment     string    `json:"comment,omitempty"`
+	CommentText string    `json:"comment_text,omitempty"`
+	Stickied    bool      `json:"stickied,omitempty"`
+	CommentDone bool      `json:"comment_done,omitempty"`
+}
+
+// LiveComment is a bot comment on a post of the HN story HNID.
+type LiveComment struct {
+	HNID int
+	Post StoredPost
+}
+
+func (s *StoredItem) Posted() bool {
+	return s.RedditName != ""
+}
+
+// PostIn returns the item's post in subreddit. Items posted before
+// subreddits were tracked match any subreddit.
+func (s *StoredItem) PostIn(subreddit string) (StoredPost, bool) {
+	if len(s.Posts) == 0 && s.RedditName != "" {
+		return StoredPost{Name: s.RedditName, PostedAt: s.PostedAt}, true
+	}
+	for _, p := range s.Posts {
+		if p.Subreddit == "" || strings.EqualFold(p.Subreddit, subreddit) {
+			return p, true
+		}
+	}
+	return StoredPost{}, false
+}
+
+// ResolvedURL caches where a shortened link ended up.
+type ResolvedURL struct {
+	Final      string    `json:"final"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// CanonicalURL caches the canonical URL a page declared. An empty
+// Canonical records that the page had none, or that the fetch failed.
+type CanonicalURL struct {
+	Canonical string    `json:"canonical,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// DiscussionHistory caches the previous HN discussions of a URL.
+type DiscussionHistory struct {
+	Discussions []PreviousDiscussion `json:"discussions,omitempty"`
+	FetchedAt   time.Time            `json:"fetched_at"`
+}
+
+type storeData struct {
+	Version     int                           `json:"version"`
+	Items       map[string]*StoredItem        `json:"items"`
+	Resolved    map[string]*ResolvedURL       `json:"resolved,omitempty"`
+	Canonical   map[string]*CanonicalURL      `json:"canonical,omitempty"`
+	Discussions map[string]*DiscussionHistory `json:"discussions,omitempty"`
+	// BannedDomains maps "subreddit/domain" to when Reddit refused a link
+	// to domain in subreddit.
+	BannedDomains map[string]time.Time `json:"banned_domains,omitempty"`
+}
+
+// Store is a JSON file on disk holding every item the bot has seen and
+// posted. It survives between runs so dedupe isn't limited to whatever
+// the subreddit listings happen to return.
+type Store struct {
+	mu     sync.Mutex
+	path   string
+	data   storeData
+	byURL  map[string][]*StoredItem
+	byHNID map[int]*StoredItem
+	// byLink indexes items by their raw link and where it resolved to,
+	// which are the keys of the Resolved and Canonical caches.
+	byLink map[string][]*StoredItem
+	// readOnly makes Save a no-op, so a dry run can use the store without
+	// changing the state file.
+	readOnly bool
+}
+
+func openStore(path string) (*Store, error) {
+	if path == "" {
+		return nil, errors.New("store path is empty")
+	}
+
+	s := &Store{
+		path: path,
+		data: storeData{
+			Version:       STORE_VERSION,
+			Items:         make(map[string]*StoredItem),
+			Resolved:      make(map[string]*ResolvedURL),
+			Canonical:     make(map[string]*CanonicalURL),
+			Discussions:   make(map[string]*DiscussionHistory),
+			BannedDomains: make(map[string]time.Time),
+		},
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read store %s: %w", path, err)
+	}
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &s.data); err != nil {
+			return nil, fmt.Errorf("failed to parse store %s: %w", path, err)
+		}
+		if s.data.Version > STORE_VERSION {
+			return nil, fmt.Errorf("store %s has version %d, newer than supported %d", path, s.data.Version, STORE_VERSION)
+		}
+		if s.data.Items == nil {
+			s.data.Items = make(map[string]*StoredItem)
+		}
+		if s.data.Resolved == nil {
+			s.data.Resolved = make(map[string]*ResolvedURL)
+		}
+		if s.data.Canonical == nil {
+			s.data.Canonical = make(map[string]*CanonicalURL)
+		}
+		if s.data.Discussions == nil {
+			s.data.Discussions = make(map[string]*DiscussionHistory)
+		}
+		if s.data.BannedDomains == nil {
+			s.data.BannedDomains = make(map[string]time.Time)
+		}
+		s.data.Version = STORE_VERSION
+	}
+
+	s.reindex()
+
+	return s, nil
+}
+
+// normalizeLocked normalizes rawURL, first swapping in its resolved target
+// and then that page's canonical URL where those are cached.
+func (s *Store) normalizeLocked(rawURL string) string {
+	u := rawURL
+	if r, ok := s.data.Resolved[u]; ok {
+		u = r.Final
+	}
+	if c, ok := s.data.Canonical[u]; ok && c.Canonical != "" {
+		u = c.Canonical
+	}
+	return normalizeURL(u)
+}
+
+// reindex rebuilds the indexes. URLs are re-normalized from the raw link
+// rather than trusting NormalizedURL, so changes to normalizeURL apply to
+// old records too.
+func (s *Store) reindex() {
+	s.byURL = make(map[string][]*StoredItem, len(s.data.Items))
+	s.byHNID = make(map[int]*StoredItem, len(s.data.Items))
+	s.byLink = make(map[string][]*StoredItem, len(s.data.Items))
+	for _, it := range s.data.Items {
+		if it.HNID == 0 {
+			it.HNID = hnItemID(it.GUID)
+		}
+		it.NormalizedURL = s.normalizeLocked(it.URL)
+		s.indexLocked(it)
+	}
+}
+
+// linksLocked returns the cache keys its normalized URL depends on: its
+// raw link and, if that was resolved, where it ended up.
+func (s *Store) linksLocked(it *StoredItem) []string {
+	links := []string{it.URL}
+	if r, ok := s.data.Resolved[it.URL]; ok && r.Final != it.URL {
+		links = append(links, r.Final)
+	}
+	return links
+}
+
+// indexLocked adds it to the indexes. Posted items win the HN ID slot, and
+// every item sharing a URL is kept since each may be posted to a
+// different subreddit.
+func (s *Store) indexLocked(it *StoredItem) {
+	if it.HNID != 0 {
+		if prev, ok := s.byHNID[it.HNID]; !ok || !prev.Posted() || it.Posted() {
+			s.byHNID[it.HNID] = it
+		}
+	}
+
+	for _, link := range s.linksLocked(it) {
+		if link != "" && !slices.Contains(s.byLink[link], it) {
+			s.byLink[link] = append(s.byLink[link], it)
+		}
+	}
+
+	if it.NormalizedURL == "" || slices.Contains(s.byURL[it.NormalizedURL], it) {
+		return
+	}
+	s.byURL[it.NormalizedURL] = append(s.byURL[it.NormalizedURL], it)
+}
+
+// unindexLocked drops it from the URL and link indexes, before its link
+// or the caches it depends on change.
+func (s *Store) unindexLocked(it *StoredItem) {
+	unindex(s.byURL, it.NormalizedURL, it)
+	for _, link := range s.linksLocked(it) {
+		unindex(s.byLink, link, it)
+	}
+}
+
+func unindex(index map[string][]*StoredItem, key string, it *StoredItem) {
+	items := index[key]
+	if i := slices.Index(items, it); i >= 0 {
+		items = slices.Delete(items, i, i+1)
+	}
+	if len(items) == 0 {
+		delete(index, key)
+	} else {
+		index[key] = items
+	}
+}
+
+// renormalizeLocked updates the items whose normalized URL depends on
+// link after update changes the caches.
+func (s *Store) renormalizeLocked(link string, update func()) {
+	items := slices.Clone(s.byLink[link])
+	for _, it := range items {
+		s.unindexLocked(it)
+	}
+	update()
+	for _, it := range items {
+		it.NormalizedURL = s.normalizeLocked(it.URL)
+		s.indexLocked(it)
+	}
+}
+
+// storeKey is the HN item URL, which is what hnrss uses as the GUID, so
+// state written before stories came from other sources still matches.
+func storeKey(story Story) string {
+	if story.ID != 0 {
+		return hnItemURL(story.ID)
+	}
+	return story.URL
+}
+
+// Seen records that story appeared in the feed.
+func (s *Store) Seen(story Story) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	key := storeKey(story)
+
+	it, ok := s.data.Items[key]
+	if !ok {
+		it = &StoredItem{
+			GUID:      story.HNURL(),
+			HNID:      story.ID,
+			FirstSeen: now,
+		}
+		s.data.Items[key] = it
+	}
+
+	s.unindexLocked(it)
+
+	it.URL = story.URL
+	it.Title = story.Title
+	it.LastSeen = now
+	it.NormalizedURL = s.normalizeLocked(story.URL)
+
+	s.indexLocked(it)
+}
+
+// RecordPost marks story as submitted to subreddit as redditName and
+// writes the store to disk straight away, so a crash later in the run
+// can't lose it.
+func (s *Store) RecordPost(story Story, subreddit, redditName string) error {
+	if redditName == "" {
+		return errors.New("reddit name is empty")
+	}
+
+	s.Seen(story)
+
+	s.mu.Lock()
+	it := s.data.Items[storeKey(story)]
+	now := time.Now().UTC()
+	if !it.Posted() {
+		it.RedditName = redditName
+		it.PostedAt = now
+	}
+	it.Posts = append(it.Posts, StoredPost{Subreddit: subreddit, Name: redditName, PostedAt: now})
+	s.indexLocked(it)
+	s.mu.Unlock()
+
+	return s.Save()
+}
+
+// RecordAlreadySubmitted marks story as posted to subreddit by someone
+// else, after Reddit refused it as ALREADY_SUB, so later runs skip it. The
+// post has no name since Reddit doesn't say which post it was.
+func (s *Store) RecordAlreadySubmitted(story Story, subreddit string) error {
+	s.Seen(story)
+
+	s.mu.Lock()
+	it := s.data.Items[storeKey(story)]
+	it.Posts = append(it.Posts, StoredPost{Subreddit: subreddit, PostedAt: time.Now().UTC()})
+	s.mu.Unlock()
+
+	return s.Save()
+}
+
+// BanDomain records that Reddit refused links to domain in subreddit.
+func (s *Store) BanDomain(subreddit, domain string) error {
+	s.mu.Lock()
+	s.data.BannedDomains[bannedDomainKey(subreddit, domain)] = time.Now().UTC()
+	s.mu.Unlock()
+
+	return s.Save()
+}
+
+// DomainBanned reports whether links to domain were refused in subreddit
+// within the last DOMAIN_QUARANTINE.
+func (s *Store) DomainBanned(subreddit, domain string) bool {
+	if s == nil || domain == "" {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at, ok := s.data.BannedDomains[bannedDomainKey(subreddit, domain)]
+	return ok && time.Since(at) < DOMAIN_QUARANTINE
+}
+
+func bannedDomainKey(subreddit, domain string) string {
+	return strings.ToLower(subreddit) + "/" + strings.ToLower(domain)
+}
+
+// RecordComment notes the bot's comment on the post named postName, what
+// it said and whether it has been stickied, and saves the store.
+func (s *Store) RecordComment(postName, commentName, text string, stickied bool) error {
+	return s.updatePost(postName, func(p *StoredPost) {
+		p.Comment = commentName
+		p.CommentText = text
+		p.Stickied = stickied
+	})
+}
+
+// SetStickied notes that the comment on postName has been stickied.
+func (s *Store) SetStickied(postName string) error {
+	return s.updatePost(postName, func(p *StoredPost) { p.Stickied = true })
+}
+
+// UpdateComment notes the new text of the comment on postName, and
+// whether it is done being updated.
+func (s *Store) UpdateComment(postName, text string, done bool) error {
+	return s.updatePost(postName, func(p *StoredPost) {
+		p.CommentText = text
+		p.CommentDone = done
+	})
+}
+
+func (s *Store) updatePost(name string, update func(*StoredPost)) error {
+	s.mu.Lock()
+	p := s.postLocked(name)
+	if p == nil {
+		s.mu.Unlock()
+		return fmt.Errorf("no stored post %s", name)
+	}
+	update(p)
+	s.mu.Unlock()
+
+	return s.Save()
+}
+
+// UnstickiedComments returns the posts made since since whose comment
+// hasn't been stickied yet.
+func (s *Store) UnstickiedComments(since time.Time) []StoredPost {
+	var posts []StoredPost
+	for _, lc := range s.comments(since) {
+		if !lc.Post.Stickied {
+			posts = append(posts, lc.Post)
+		}
+	}
+	return posts
+}
+
+// LiveComments returns the bot comments on posts made since since that
+// are still being kept up to date.
+func (s *Store) LiveComments(since time.Time) []LiveComment {
+	var live []LiveComment
+	for _, lc := range s.comments(since) {
+		if !lc.Post.CommentDone && lc.HNID != 0 {
+			live = append(live, lc)
+		}
+	}
+	return live
+}
+
+// comments returns every post made since since that has a bot comment,
+// oldest first.
+func (s *Store) comments(since time.Time) []LiveComment {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var comments []LiveComment
+	for _, it := range s.data.Items {
+		for _, p := range it.Posts {
+			if p.Comment != "" && p.PostedAt.After(since) {
+				comments = append(comments, LiveComment{HNID: it.HNID, Post: p})
+			}
+		}
+	}
+	slices.SortFunc(comments, func(a, b LiveComment) int { return a.Post.PostedAt.Compare(b.Post.PostedAt) })
+	return comments
+}
+
+func (s *Store) postLocked(name string) *StoredPost {
+	for _, it := range s.data.Items {
+		for i := range it.Posts {
+			if it.Posts[i].Name == name {
+				return &it.Posts[i]
+			}
+		}
+	}
+	return nil
+}
+
+// FindPosted returns the stored item posted to subreddit with the given
+// normalized URL, and that post.
+func (s *Store) FindPosted(normalizedURL, subreddit string) (*StoredItem, StoredPost, bool) {
+	if s == nil || normalizedURL == "" {
+		return nil, StoredPost{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, it := range s.byURL[normalizedURL] {
+		if p, ok := it.PostIn(subreddit); ok {
+			return it, p, true
+		}
+	}
+	return nil, StoredPost{}, false
+}
+
+// FindPostedHN returns the stored item posted to subreddit for the given
+// HN story, and that post.
+func (s *Store) FindPostedHN(hnID int, subreddit string) (*StoredItem, StoredPost, bool) {
+	if s == nil || hnID == 0 {
+		return nil, StoredPost{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.byHNID[hnID]
+	if !ok {
+		return nil, StoredPost{}, false
+	}
+	p, ok := it.PostIn(subreddit)
+	if !ok {
+		return nil, StoredPost{}, false
+	}
+	return it, p, true
+}
+
+// Find returns a copy of the stored item for an HN story, or failing that
+// a normalized URL, whether or not it was posted.
+func (s *Store) Find(hnID int, normalizedURL string) (StoredItem, bool) {
+	if s == nil {
+		return StoredItem{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if it, ok := s.byHNID[hnID]; ok && hnID != 0 {
+		return *it, true
+	}
+	items := s.byURL[normalizedURL]
+	for _, it := range items {
+		if it.Posted() {
+			return *it, true
+		}
+	}
+	if len(items) > 0 {
+		return *items[0], true
+	}
+	return StoredItem{}, false
+}
+
+// Resolved returns the cached final URL for a shortened link.
+func (s *Store) Resolved(rawURL string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.data.Resolved[rawURL]
+	if !ok {
+		return "", false
+	}
+	return r.Final, true
+}
+
+// SetResolved caches the final URL for a shortened link.
+func (s *Store) SetResolved(rawURL, final string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.renormalizeLocked(rawURL, func() {
+		s.data.Resolved[rawURL] = &ResolvedURL{
+			Final:      final,
+			ResolvedAt: time.Now().UTC(),
+		}
+	})
+}
+
+// Canonical returns the cached canonical lookup for a page.
+func (s *Store) Canonical(rawURL string) (CanonicalURL, bool) {
+	if s == nil {
+		return CanonicalURL{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.data.Canonical[rawURL]
+	if !ok {
+		return CanonicalURL{}, false
+	}
+	return *c, true
+}
+
+// SetCanonical caches the canonical URL for a page; empty means none.
+func (s *Store) SetCanonical(rawURL, canonical string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.renormalizeLocked(rawURL, func() {
+		s.data.Canonical[rawURL] = &CanonicalURL{
+			Canonical: canonical,
+			FetchedAt: time.Now().UTC(),
+		}
+	})
+}
+
+// Discussions returns the cached previous discussions of a normalized URL.
+func (s *Store) Discussions(normalizedURL string) (DiscussionHistory, bool) {
+	if s == nil {
+		return DiscussionHistory{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.data.Discussions[normalizedURL]
+	if !ok {
+		return DiscussionHistory{}, false
+	}
+	return *d, true
+}
+
+// SetDiscussions caches the previous discussions of a normalized URL.
+func (s *Store) SetDiscussions(normalizedURL string, discussions []PreviousDiscussion) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Discussions[normalizedURL] = &DiscussionHistory{
+		Discussions: discussions,
+		FetchedAt:   time.Now().UTC(),
+	}
+}
+
+// Prune forgets items last seen or posted before before, along with
+// cached lookups made before then that no remaining item depends on and
+// domain bans that have run out. It returns how many entries went.
+func (s *Store) Prune(before time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	for key, it := range s.data.Items {
+		if it.lastActive().After(before) {
+			continue
+		}
+		s.unindexLocked(it)
+		if s.byHNID[it.HNID] == it {
+			delete(s.byHNID, it.HNID)
+		}
+		delete(s.data.Items, key)
+		pruned++
+	}
+
+	for link, r := range s.data.Resolved {
+		if r.ResolvedAt.Before(before) && len(s.byLink[link]) == 0 {
+			delete(s.data.Resolved, link)
+			pruned++
+		}
+	}
+	for link, c := range s.data.Canonical {
+		if c.FetchedAt.Before(before) && len(s.byLink[link]) == 0 {
+			delete(s.data.Canonical, link)
+			pruned++
+		}
+	}
+	for u, d := range s.data.Discussions {
+		if d.FetchedAt.Before(before) {
+			delete(s.data.Discussions, u)
+			pruned++
+		}
+	}
+	for key, at := range s.data.BannedDomains {
+		if time.Since(at) >= DOMAIN_QUARANTINE {
+			delete(s.data.BannedDomains, key)
+			pruned++
+		}
+	}
+
+	return pruned
+}
+
+// lastActive is when the item was last seen in a feed or posted.
+func (s *StoredItem) lastActive() time.Time {
+	last := s.LastSeen
+	for _, p := range s.Posts {
+		if p.PostedAt.After(last) {
+			last = p.PostedAt
+		}
+	}
+	if s.PostedAt.After(last) {
+		last = s.PostedAt
+	}
+	return last
+}
+
+// Save writes the store atomically via a temp file and rename, unless it
+// is read-only.
+func (s *Store) Save() error {
+	if s.readOnly {
+		return nil
+	}
+
+	s.mu.Lock()
+	raw, err := json.Marshal(&s.data)
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode store: %w", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp store file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close store: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace store: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorePersistsPosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	st, err := openStore(path)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	posted := Story{
+		ID:    1,
+		URL:   "https://www.example.com/article/",
+		Title: "An article",
+	}
+	seen := Story{
+		ID:    2,
+		URL:   "https://example.com/other",
+		Title: "Another article",
+	}
+
+	st.Seen(seen)
+	if err := st.RecordPost(posted, "hackernews", "t3_abc123"); err != nil {
+		t.Fatalf("RecordPost: %v", err)
+	}
+
+	reopened, err := openStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+
+	it, _, ok := reopened.FindPosted(normalizeURL("http://example.com/article"), "hackernews")
+	if !ok {
+		t.Fatal("posted item not found after reopening store")
+	}
+	if it.RedditName != "t3_abc123" {
+		t.Errorf("RedditName = %q, want %q", it.RedditName, "t3_abc123")
+	}
+	if it.FirstSeen.IsZero() || it.PostedAt.IsZero() {
+		t.Errorf("timestamps not recorded: %+v", it)
+	}
+
+	if _, _, ok := reopened.FindPosted(normalizeURL(seen.URL), "hackernews"); ok {
+		t.Error("seen but unposted item should not be reported as posted")
+	}
+}
+
+func TestIsDuplicateChecksStore(t *testing.T) {
+	st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	item := Story{
+		ID:    3,
+		URL:   "https://example.com/old-story",
+		Title: "An old story",
+	}
+	if err := st.RecordPost(item, "hackernews", "t3_old"); err != nil {
+		t.Fatalf("RecordPost: %v", err)
+	}
+
+	// No listings at all: the store alone should catch the repost.
+	if !isDuplicate(st, "hackernews", 0, normalizeURL(item.URL), "A retitled story", nil, time.Now(), DEFAULT_TITLE_THRESHOLD) {
+		t.Error("expected stored post to be detected as duplicate")
+	}
+}
+
+func TestStoreDedupesPerSubreddit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err := openStore(path)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	story := Story{ID: 9, URL: "https://example.com/routed", Title: "Routed story"}
+	if err := st.RecordPost(story, "ShowHN", "t3_show"); err != nil {
+		t.Fatalf("RecordPost: %v", err)
+	}
+
+	if !isDuplicate(st, "showhn", 9, normalizeURL(story.URL), story.Title, nil, time.Now(), DEFAULT_TITLE_THRESHOLD) {
+		t.Error("story should be a duplicate in the subreddit it was posted to")
+	}
+	if isDuplicate(st, "hackernews", 9, normalizeURL(story.URL), story.Title, nil, time.Now(), DEFAULT_TITLE_THRESHOLD) {
+		t.Error("story posted to r/ShowHN should still be postable to r/hackernews")
+	}
+
+	// A record from before posts were tracked per subreddit blocks every target.
+	legacy := Story{ID: 10, URL: "https://example.com/legacy", Title: "Legacy"}
+	st.Seen(legacy)
+	st.mu.Lock()
+	it := st.data.Items[storeKey(legacy)]
+	it.RedditName, it.PostedAt = "t3_legacy", time.Now()
+	st.mu.Unlock()
+	if err := st.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if _, post, ok := reopened.FindPostedHN(10, "anything"); !ok || post.Name != "t3_legacy" {
+		t.Errorf("legacy post should match any subreddit, got %+v, %v", post, ok)
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	old := Story{ID: 20, URL: "https://bit.ly/old", Title: "Old story"}
+	recent := Story{ID: 21, URL: "https://bit.ly/recent", Title: "Recent story"}
+	st.SetResolved(old.URL, "https://example.com/old")
+	st.SetResolved(recent.URL, "https://example.com/recent")
+	st.SetResolved("https://bit.ly/unused", "https://example.com/unused")
+	st.Seen(old)
+	if err := st.RecordPost(recent, "hackernews", "t3_recent"); err != nil {
+		t.Fatalf("RecordPost: %v", err)
+	}
+
+	// Age everything but the recent post.
+	longAgo := time.Now().Add(-200 * 24 * time.Hour)
+	st.mu.Lock()
+	st.data.Items[storeKey(old)].LastSeen = longAgo
+	st.data.Items[storeKey(recent)].LastSeen = longAgo
+	for _, r := range st.data.Resolved {
+		r.ResolvedAt = longAgo
+	}
+	st.data.BannedDomains[bannedDomainKey("hackernews", "example.com")] = longAgo
+	st.mu.Unlock()
+
+	if n := st.Prune(time.Now().Add(-90 * 24 * time.Hour)); n != 4 {
+		t.Errorf("pruned %d entries, want 4 (old item, its lookup, unused lookup, expired ban)", n)
+	}
+
+	if _, ok := st.Find(20, normalizeURL("https://example.com/old")); ok {
+		t.Error("old item should be pruned")
+	}
+	if _, _, ok := st.FindPosted(normalizeURL("https://example.com/recent"), "hackernews"); !ok {
+		t.Error("recently posted item should be kept")
+	}
+	if _, ok := st.Resolved(recent.URL); !ok {
+		t.Error("lookup used by a kept item should be kept")
+	}
+	if _, ok := st.Resolved("https://bit.ly/unused"); ok {
+		t.Error("old unused lookup should be pruned")
+	}
+}
+
+func TestStoreCachesUpdateIndex(t *testing.T) {
+	st, err := openStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+
+	story := Story{ID: 30, URL: "https://t.co/abc", Title: "Shortened"}
+	if err := st.RecordPost(story, "hackernews", "t3_short"); err != nil {
+		t.Fatalf("RecordPost: %v", err)
+	}
+
+	st.SetResolved(story.URL, "https://example.com/page?utm_source=x")
+	st.SetCanonical("https://example.com/page?utm_source=x", "https://example.com/canonical")
+
+	if _, _, ok := st.FindPosted(normalizeURL("https://example.com/canonical"), "hackernews"); !ok {
+		t.Error("item should be indexed under its canonical URL")
+	}
+	for _, stale := range []string{story.URL, "https://example.com/page"} {
+		if _, _, ok := st.FindPosted(normalizeURL(stale), "hackernews"); ok {
+			t.Errorf("item should no longer be indexed under %s", stale)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DEFAULT_TITLE_TEMPLATE = `{{.Title}}`
+
+	DEFAULT_COMMENT_TEMPLATE = `Discussion on HN: {{.HNURL}}
+{{- with .Stats}}
+
+{{.}}
+{{- end}}
+{{- with .Previous}}
+
+{{previous .}}
+{{- end}}`
+)
+
+// TemplateData is what the title and comment templates are executed with.
+type TemplateData struct {
+	ID           int
+	Title        string
+	URL          string
+	HNURL        string
+	Domain       string
+	Type         string
+	Author       string
+	Points       int
+	Comments     int
+	Time         time.Time
+	Age          string
+	Stats        string
+	Previous     []PreviousDiscussion
+	Wayback      string
+	ArchiveToday string
+}
+
+func newTemplateData(story Story, previous []PreviousDiscussion, now time.Time) TemplateData {
+	d := TemplateData{
+		ID:       story.ID,
+		Title:    story.Title,
+		URL:      story.URL,
+		HNURL:    story.HNURL(),
+		Type:     story.Type,
+		Author:   story.Author,
+		Points:   story.Points,
+		Comments: story.Comments,
+		Time:     story.Time,
+		Stats:    storyStats(story, now),
+		Previous: previous,
+	}
+	if !story.Time.IsZero() {
+		d.Age = humanAge(now.Sub(story.Time))
+	}
+	if !story.IsText() {
+		d.Domain = linkDomain(story.URL)
+		d.Wayback = "https://web.archive.org/web/" + story.URL
+		d.ArchiveToday = "https://archive.ph/newest/" + story.URL
+	}
+	return d
+}
+
+var templateFuncs = template.FuncMap{
+	"md":       markdownEscaper.Replace,
+	"truncate": truncateRunes,
+	"plural":   plural,
+	"previous": previousDiscussionsMarkdown,
+	"date":     func(t time.Time) string { return t.Format("2006-01-02") },
+}
+
+// Templates renders post titles and bot comments. A nil Templates uses
+// the built-in templates.
+type Templates struct {
+	title   *template.Template
+	comment *template.Template
+}
+
+var defaultTemplates = mustTemplates(DEFAULT_TITLE_TEMPLATE, DEFAULT_COMMENT_TEMPLATE)
+
+// newTemplates parses the configured templates and tries them on sample
+// data, so a typo in a field name fails at startup rather than on the
+// first post.
+func newTemplates(cfg *Config) (*Templates, error) {
+	titleSrc, commentSrc := cfg.Templates.Title, cfg.Templates.Comment
+	if titleSrc == "" {
+		titleSrc = DEFAULT_TITLE_TEMPLATE
+	}
+	if commentSrc == "" {
+		commentSrc = DEFAULT_COMMENT_TEMPLATE
+	}
+
+	t := &Templates{}
+	var err error
+	if t.title, err = parseTemplate("templates.title", titleSrc); err != nil {
+		return nil, err
+	}
+	if t.comment, err = parseTemplate("templates.comment", commentSrc); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func mustTemplates(title, comment string) *Templates {
+	return &Templates{
+		title:   template.Must(parseTemplate("title", title)),
+		comment: template.Must(parseTemplate("comment", comment)),
+	}
+}
+
+func parseTemplate(name, src string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := Story{ID: 1, Title: "Sample", URL: "https://example.com/", Points: 1, Comments: 1, Author: "pg", Time: time.Now(), Type: STORY_TYPE_STORY}
+	prev := []PreviousDiscussion{{HNID: 2, Title: "Sample", Points: 1, Comments: 1, CreatedAt: time.Now()}}
+	if err := tmpl.Execute(&bytes.Buffer{}, newTemplateData(sample, prev, time.Now())); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+func (t *Templates) get() *Templates {
+	if t == nil {
+		return defaultTemplates
+	}
+	return t
+}
+
+// Title renders the title to post data's story under. If the template
+// fails or comes out empty the HN title is used.
+func (t *Templates) Title(data TemplateData) string {
+	title, err := execTemplate(t.get().title, data)
+	if err != nil {
+		logger.Printf("Warning: failed to render title for %q: %v\n", data.Title, err)
+		return data.Title
+	}
+	if title == "" {
+		return data.Title
+	}
+	return title
+}
+
+// Comment renders the bot comment for data's story. If the template fails
+// the built-in one is used; an empty result means no comment.
+func (t *Templates) Comment(data TemplateData) string {
+	comment, err := execTemplate(t.get().comment, data)
+	if err != nil {
+		logger.Printf("Warning: failed to render comment for %q: %v\n", data.Title, err)
+		comment, _ = execTemplate(defaultTemplates.comment, data)
+	}
+	return comment
+}
+
+func execTemplate(tmpl *template.Template, data TemplateData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// truncateRunes cuts s to at most n runes, ending in "…" if it was cut.
+func truncateRunes(n int, s string) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:n-1])) + "…"
+}
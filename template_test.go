@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplates(t *testing.T) {
+	now := time.Now()
+	story := Story{
+		ID:       42,
+		Title:    "Why *stars* break [markdown]",
+		URL:      "https://www.example.com/post",
+		Points:   120,
+		Comments: 30,
+		Author:   "pg",
+		Time:     now.Add(-3 * time.Hour),
+		Type:     STORY_TYPE_STORY,
+	}
+	prev := []PreviousDiscussion{{HNID: 7, Points: 50, Comments: 20, CreatedAt: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)}}
+	data := newTemplateData(story, prev, now)
+
+	var defaults *Templates
+	if got := defaults.Title(data); got != story.Title {
+		t.Errorf("default title = %q, want the HN title", got)
+	}
+	want := "Discussion on HN: https://news.ycombinator.com/item?id=42\n\n" +
+		"*120 points, 30 comments, posted 3 hours ago*\n\n" +
+		"Previous discussions:\n\n- [2020-01-02](https://news.ycombinator.com/item?id=7) (50 points, 20 comments)"
+	if got := defaults.Comment(data); got != want {
+		t.Errorf("default comment = %q, want %q", got, want)
+	}
+
+	cfg := defaultConfig()
+	cfg.Templates.Title = `{{.Title | truncate 12}} [{{.Domain}}]`
+	cfg.Templates.Comment = `[{{.Title | md}}]({{.HNURL}}) by {{.Author}}, {{plural .Points "point"}}, {{.Age}} old. [archive]({{.Wayback}})`
+	tmpl, err := newTemplates(cfg)
+	if err != nil {
+		t.Fatalf("newTemplates: %v", err)
+	}
+
+	if got, want := tmpl.Title(data), "Why *stars*… [example.com]"; got != want {
+		t.Errorf("title = %q, want %q", got, want)
+	}
+	want = `[Why \*stars\* break \[markdown\]](https://news.ycombinator.com/item?id=42) by pg, 120 points, 3 hours old. [archive](https://web.archive.org/web/https://www.example.com/post)`
+	if got := tmpl.Comment(data); got != want {
+		t.Errorf("comment = %q, want %q", got, want)
+	}
+}
+
+func TestTemplatesValidated(t *testing.T) {
+	testCases := []struct {
+		name    string
+		title   string
+		comment string
+		wantErr string
+	}{
+		{"Syntax", `{{.Title`, "", "templates.title"},
+		{"Unknown field", "", `{{.Score}}`, "templates.comment"},
+		{"Unknown function", `{{upper .Title}}`, "", "upper"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.Templates.Title = tc.title
+			cfg.Templates.Comment = tc.comment
+
+			_, err := newTemplates(cfg)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got %v, want an error mentioning %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DEFAULT_TITLE_THRESHOLD is the score at or above which two titles are
+// considered the same story.
+const DEFAULT_TITLE_THRESHOLD = 0.6
+
+// TitleSimilarity is the result of comparing two titles: a score between
+// 0 and 1 and a human-readable reason for it.
+type TitleSimilarity struct {
+	Score  float64
+	Reason string
+}
+
+// hnPrefixRegex matches the "Show HN:"-style labels HN puts on titles.
+var hnPrefixRegex = regexp.MustCompile(`(?i)^\s*(show|ask|tell|launch)\s+hn\s*[:\-–—]\s*`)
+
+// hnSuffixRegex matches trailing [pdf]/[video] and (2019)-style markers.
+var hnSuffixRegex = regexp.MustCompile(`(?i)(\s*(\[(pdf|video|audio|slides)\]|\((\d{4}|\d{4}s|\d{4}[-–]\d{2,4})\)))+\s*$`)
+
+// titleSeparatorRegex splits a title into its head and tagline.
+var titleSeparatorRegex = regexp.MustCompile(`\s+[-–—|]\s+|:\s+`)
+
+var titleStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "can": true, "do": true, "for": true, "from": true,
+	"has": true, "have": true, "how": true, "i": true, "in": true, "into": true,
+	"is": true, "it": true, "its": true, "my": true, "new": true, "of": true,
+	"on": true, "or": true, "our": true, "so": true, "that": true, "the": true,
+	"this": true, "to": true, "via": true, "vs": true, "was": true, "we": true,
+	"what": true, "when": true, "why": true, "will": true, "with": true,
+	"you": true, "your": true,
+}
+
+var foldTransformer = transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// foldTitle lowercases and strips accents, so "Café" and "cafe" compare
+// equal.
+func foldTitle(title string) string {
+	folded, _, err := transform.String(foldTransformer, title)
+	if err != nil {
+		folded = title
+	}
+	return strings.ToLower(folded)
+}
+
+// stripTitleMarkers removes HN prefixes and suffix markers.
+func stripTitleMarkers(title string) string {
+	title = hnPrefixRegex.ReplaceAllString(title, "")
+	title = hnSuffixRegex.ReplaceAllString(title, "")
+	return strings.TrimSpace(title)
+}
+
+// stemWord is a deliberately light suffix stripper: enough to match
+// "chips"/"chip" and "released"/"release" without a full stemmer.
+func stemWord(w string) string {
+	if len(w) <= 4 {
+		return strings.TrimSuffix(w, "s")
+	}
+	for _, suffix := range []string{"ing", "ies", "ed", "es", "s"} {
+		if strings.HasSuffix(w, suffix) && len(w)-len(suffix) >= 3 {
+			stem := strings.TrimSuffix(w, suffix)
+			if suffix == "ies" {
+				stem += "y"
+			}
+			return stem
+		}
+	}
+	return w
+}
+
+// titleTokens turns a title into folded, stemmed words with stopwords
+// and HN markers removed.
+func titleTokens(title string) []string {
+	words := strings.FieldsFunc(foldTitle(stripTitleMarkers(title)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '+' && r != '#'
+	})
+
+	tokens := make([]string, 0, len(words))
+	for _, w := range words {
+		if titleStopwords[w] {
+			continue
+		}
+		tokens = append(tokens, stemWord(w))
+	}
+	return tokens
+}
+
+func tokenSet(tokens []string) map[string]bool {
+	set := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		set[t] = true
+	}
+	return set
+}
+
+func shingleSet(tokens []string) map[string]bool {
+	set := make(map[string]bool)
+	for i := 0; i+1 < len(tokens); i++ {
+		set[tokens[i]+" "+tokens[i+1]] = true
+	}
+	return set
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for k := range a {
+		if b[k] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+func overlap(a, b map[string]bool) float64 {
+	smaller := min(len(a), len(b))
+	if smaller == 0 {
+		return 0
+	}
+	inter := 0
+	for k := range a {
+		if b[k] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(smaller)
+}
+
+// isLaunchTitle reports whether title has a Show HN or Launch HN prefix,
+// which says the rest is a product's name.
+func isLaunchTitle(title string) bool {
+	matches := hnPrefixRegex.FindStringSubmatch(title)
+	return len(matches) > 1 && (strings.EqualFold(matches[1], "show") || strings.EqualFold(matches[1], "launch"))
+}
+
+// titleHead returns the part of a title before its first separator, or
+// the empty string if it has none.
+func titleHead(title string) string {
+	loc := titleSeparatorRegex.FindStringIndex(title)
+	if loc == nil {
+		return ""
+	}
+	return title[:loc[0]]
+}
+
+// compareTitles scores how likely two titles describe the same story.
+func compareTitles(title1, title2 string) TitleSimilarity {
+	tokens1 := titleTokens(title1)
+	tokens2 := titleTokens(title2)
+
+	if len(tokens1) == 0 || len(tokens2) == 0 {
+		return TitleSimilarity{Reason: "no comparable words"}
+	}
+
+	if strings.Join(tokens1, " ") == strings.Join(tokens2, " ") {
+		return TitleSimilarity{Score: 1, Reason: "identical after normalization"}
+	}
+
+	// "Show HN: Foo" vs "Foo – a tool for X": one title is just the
+	// other's name. A one-word name only counts behind Show or Launch HN,
+	// or "Rust" would match every "Rust: ..." title.
+	for _, pair := range [][2]string{{title1, title2}, {title2, title1}} {
+		whole, other := stripTitleMarkers(pair[0]), stripTitleMarkers(pair[1])
+		if titleHead(whole) != "" {
+			continue
+		}
+		head := titleTokens(titleHead(other))
+		if len(head) == 0 || strings.Join(head, " ") != strings.Join(titleTokens(whole), " ") {
+			continue
+		}
+		if len(head) >= 2 || isLaunchTitle(pair[0]) {
+			return TitleSimilarity{Score: 0.9, Reason: fmt.Sprintf("%q is the name in %q", whole, other)}
+		}
+	}
+
+	set1, set2 := tokenSet(tokens1), tokenSet(tokens2)
+
+	if min(len(set1), len(set2)) >= 4 {
+		if o := overlap(set1, set2); o >= 0.9 {
+			return TitleSimilarity{Score: o, Reason: fmt.Sprintf("one title contains the other (%.0f%% word overlap)", o*100)}
+		}
+	}
+
+	wordScore := jaccard(set1, set2)
+	score := wordScore
+	shingles1, shingles2 := shingleSet(tokens1), shingleSet(tokens2)
+	if len(shingles1) > 0 && len(shingles2) > 0 {
+		score = (wordScore + jaccard(shingles1, shingles2)) / 2
+	}
+
+	return TitleSimilarity{
+		Score:  score,
+		Reason: fmt.Sprintf("%.0f%% word and phrase overlap", score*100),
+	}
+}
+
+// isSimilarTitle reports whether two titles score at or above threshold.
+func isSimilarTitle(title1, title2 string, threshold float64) (TitleSimilarity, bool) {
+	sim := compareTitles(title1, title2)
+	return sim, sim.Score >= threshold
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTitleTokens(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []string
+	}{
+		{"Show HN: Foo – a tool for X", []string{"foo", "tool", "x"}},
+		{"Café Déjà Vu", []string{"cafe", "deja", "vu"}},
+		{"The Unix Philosophy (1994) [pdf]", []string{"unix", "philosophy"}},
+		{"Apple releases M4 chips", []string{"apple", "releas", "m4", "chip"}},
+		{"C++ vs. C# in 2025", []string{"c++", "c#", "2025"}},
+	}
+
+	for _, tc := range testCases {
+		got := titleTokens(tc.input)
+		if len(got) != len(tc.expected) {
+			t.Errorf("titleTokens(%q) = %q, want %q", tc.input, got, tc.expected)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.expected[i] {
+				t.Errorf("titleTokens(%q) = %q, want %q", tc.input, got, tc.expected)
+				break
+			}
+		}
+	}
+}
+
+// Pairs taken from the subreddit and HN front page. Same-story pairs must
+// score at or above the default threshold, different-story pairs below it.
+func TestIsSimilarTitleCorpus(t *testing.T) {
+	same := [][2]string{
+		{"Show HN: Foo", "Foo – a tool for X"},
+		{"Launch HN: Acme", "Acme: Postgres for agents"},
+		{"Deno Deploy", "Deno Deploy – Serverless JavaScript at the edge"},
+		{"Show HN: Zed – a high-performance code editor", "Zed: A high-performance, multiplayer code editor"},
+		{"Launch HN: Acme (YC W25) – Postgres for agents", "Acme (YC W25) – Postgres for agents"},
+		{"The Unix Philosophy (1994) [pdf]", "The Unix philosophy"},
+		{"Apple announces MacBook Pro with M4 chips", "Apple announces new MacBook Pro with M4 chip"},
+		{"Café owners in Paris push back on new rules", "Cafe owners in Paris push back on rules"},
+		{"Why I'm leaving Google after 15 years", "Why I'm leaving Google after 15 years [video]"},
+		{"Linux 6.9 released", "Linux 6.9 Released"},
+		{"EU age verification app to ban any Android system not licensed by Google", "EU age verification app to ban Android systems not licensed by Google"},
+		{"OpenAI releases GPT-5", "OpenAI Releases GPT-5 (2025)"},
+	}
+	different := [][2]string{
+		{"The state of Rust in 2025", "The state of Go in 2025"},
+		{"Show HN: I built a database in Rust", "Show HN: I built a compiler in Rust"},
+		{"Ask HN: What are you working on?", "Ask HN: Who is hiring?"},
+		{"Firefox 130 released", "Chrome 130 released"},
+		{"Google fined $2.4B by the EU", "Apple fined $1.8B by the EU"},
+		{"How we scaled Postgres to 1M QPS", "How we scaled Redis to 1M QPS"},
+		{"A history of the Unix shell", "A history of the Windows registry"},
+		{"Writing a compiler in Go", "Writing an interpreter in Go"},
+		{"Rust", "Rust: The state of async in 2025"},
+		{"Apple", "Apple: Q3 results"},
+		{"Ask HN: Rust", "Rust: The state of async in 2025"},
+	}
+
+	for _, pair := range same {
+		sim, ok := isSimilarTitle(pair[0], pair[1], DEFAULT_TITLE_THRESHOLD)
+		if !ok {
+			t.Errorf("expected %q and %q to match, got %.2f (%s)", pair[0], pair[1], sim.Score, sim.Reason)
+		}
+		if sim.Reason == "" {
+			t.Errorf("no reason given for %q vs %q", pair[0], pair[1])
+		}
+	}
+
+	for _, pair := range different {
+		if sim, ok := isSimilarTitle(pair[0], pair[1], DEFAULT_TITLE_THRESHOLD); ok {
+			t.Errorf("expected %q and %q not to match, got %.2f (%s)", pair[0], pair[1], sim.Score, sim.Reason)
+		}
+	}
+}
+
+func TestIsSimilarTitleThreshold(t *testing.T) {
+	a, b := "Writing a compiler in Go", "Writing an interpreter in Go"
+
+	sim, ok := isSimilarTitle(a, b, 1)
+	if ok {
+		t.Errorf("threshold 1 should only match identical titles, got %.2f", sim.Score)
+	}
+
+	if _, ok := isSimilarTitle(a, b, sim.Score); !ok {
+		t.Errorf("score %.2f should match at its own threshold", sim.Score)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// REDDIT_TITLE_LIMIT is the most characters Reddit accepts in a title.
+const REDDIT_TITLE_LIMIT = 300
+
+// YEAR_MARKER_AGE is how old a link must be before its title gets a year.
+const YEAR_MARKER_AGE = 365 * 24 * time.Hour
+
+var (
+	titleYearPathRegex = regexp.MustCompile(`/((?:19|20)\d{2})/(?:(0[1-9]|1[0-2])/)?`)
+	videoDomains       = []string{"youtube.com", "youtu.be", "vimeo.com"}
+)
+
+// cleanTitle decodes HTML entities (twice, as feeds sometimes encode them
+// twice), normalizes to NFC, drops zero-width and control characters and
+// collapses whitespace.
+func cleanTitle(title string) string {
+	for range 2 {
+		title = html.UnescapeString(title)
+	}
+	title = norm.NFC.String(title)
+	title = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\u200b' || r == '\u200c' || r == '\u200d' || r == '\ufeff':
+			return -1
+		case unicode.IsSpace(r) || unicode.IsControl(r):
+			return ' '
+		}
+		return r
+	}, title)
+	return strings.Join(strings.Fields(title), " ")
+}
+
+// truncateTitle cuts title to at most limit characters, at a word boundary
+// where there is one in the second half, ending in "…".
+func truncateTitle(title string, limit int) string {
+	if utf8.RuneCountInString(title) <= limit {
+		return title
+	}
+
+	cut := string([]rune(title)[:max(limit-1, 0)])
+	if i := strings.LastIndex(cut, " "); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:-–—") + "…"
+}
+
+// titleMarkers returns the HN-style markers for story's link: a (2019)
+// year when the URL path dates it over a year before the story, [pdf] and
+// [video]. Titles that already end in a marker get none.
+func titleMarkers(story Story, title string) string {
+	if hnSuffixRegex.MatchString(title) || story.IsText() {
+		return ""
+	}
+
+	u, err := url.Parse(story.URL)
+	if err != nil {
+		return ""
+	}
+
+	var markers string
+	if m := titleYearPathRegex.FindStringSubmatch(u.Path); m != nil {
+		now := story.Time
+		if now.IsZero() {
+			now = time.Now()
+		}
+		// The path only gives a year and maybe a month, so take the
+		// latest day it could mean: /2023/12/ posted in January is new.
+		year, _ := strconv.Atoi(m[1])
+		published := time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+		if month, err := strconv.Atoi(m[2]); err == nil {
+			published = time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		if now.Sub(published) > YEAR_MARKER_AGE {
+			markers += " (" + m[1] + ")"
+		}
+	}
+	if strings.HasSuffix(strings.ToLower(u.Path), ".pdf") {
+		markers += " [pdf]"
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if slices.ContainsFunc(parentDomains(host), func(h string) bool { return slices.Contains(videoDomains, h) }) {
+		markers += " [video]"
+	}
+	return markers
+}
+
+// submissionTitle is the title story is posted under: rendered from the
+// title template, tidied, given HN-style markers if title.markers is set
+// and cut to fit Reddit's limit with the markers kept.
+func (a *App) submissionTitle(story Story) string {
+	title := cleanTitle(a.templates.Title(newTemplateData(story, nil, time.Now())))
+
+	markers := ""
+	if a.cfg.Title.Markers {
+		markers = titleMarkers(story, title)
+	}
+	return truncateTitle(title, REDDIT_TITLE_LIMIT-utf8.RuneCountInString(markers)) + markers
+}
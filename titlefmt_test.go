@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestCleanTitle(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"Rust &amp; Go", "Rust & Go"},
+		{"It&amp;#x27;s here", "It's here"},
+		{"  Too\tmuch \n space  ", "Too much space"},
+		{"Zero\u200bwidth\ufeff", "Zerowidth"},
+		{"Café", "Café"},
+		{"Bell\x07 char", "Bell char"},
+	}
+
+	for _, tc := range testCases {
+		if got := cleanTitle(tc.input); got != tc.expected {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tc.input, got, tc.expected)
+		}
+	}
+}
+
+func TestSubmissionTitle(t *testing.T) {
+	long := strings.Repeat("word ", 80)
+	posted := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		story    Story
+		expected string
+	}{
+		{"Short", Story{Title: "A title", URL: "https://example.com/a"}, "A title"},
+		{"Old PDF", Story{Title: "A paper", URL: "https://example.com/2019/05/paper.PDF", Time: posted}, "A paper (2019) [pdf]"},
+		{"This year", Story{Title: "News", URL: "https://example.com/2024/02/news", Time: posted}, "News"},
+		{"Last month, last year", Story{Title: "News", URL: "https://example.com/2023/12/news", Time: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)}, "News"},
+		{"Last year, no month", Story{Title: "News", URL: "https://example.com/2023/news", Time: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)}, "News"},
+		{"Over a year old", Story{Title: "News", URL: "https://example.com/2023/01/news", Time: posted}, "News (2023)"},
+		{"Video", Story{Title: "A talk", URL: "https://m.youtube.com/watch?v=1"}, "A talk [video]"},
+		{"Already marked", Story{Title: "A paper [pdf]", URL: "https://example.com/paper.pdf"}, "A paper [pdf]"},
+		{"Text post", Story{ID: 1, Title: "Ask HN: Why?", URL: hnItemURL(1)}, "Ask HN: Why?"},
+		{"Long", Story{Title: long, URL: "https://example.com/a.pdf"}, strings.TrimSpace(strings.Repeat("word ", 58)) + "… [pdf]"},
+	}
+
+	app := &App{cfg: defaultConfig()}
+	app.cfg.Title.Markers = true
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := app.submissionTitle(tc.story)
+			if got != tc.expected {
+				t.Errorf("submissionTitle = %q, want %q", got, tc.expected)
+			}
+			if n := utf8.RuneCountInString(got); n > REDDIT_TITLE_LIMIT {
+				t.Errorf("title is %d characters, over the limit", n)
+			}
+		})
+	}
+}